@@ -0,0 +1,105 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/chop-dbhi/origins/chrono"
+	"github.com/chop-dbhi/origins/view"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+var diffCmd = &cobra.Command{
+	Use: "diff <domain>",
+
+	Short: "Outputs the changes to a domain between two points in time.",
+
+	Long: `diff outputs the add, change and remove events that turn the state of
+a domain as of the from time into the state as of the to time. If from is
+not supplied, every fact in the state is added. If to is not supplied, the
+current state is used.`,
+
+	Run: func(cmd *cobra.Command, args []string) {
+		bindStorageFlags(cmd.Flags())
+
+		if len(args) != 1 {
+			cmd.Usage()
+			os.Exit(1)
+		}
+
+		var (
+			err      error
+			from, to time.Time
+		)
+
+		if s := viper.GetString("diff_from"); s != "" {
+			if from, err = chrono.Parse(s); err != nil {
+				logrus.Fatalf("diff: %s", err)
+			}
+		}
+
+		if s := viper.GetString("diff_to"); s != "" {
+			if to, err = chrono.Parse(s); err != nil {
+				logrus.Fatalf("diff: %s", err)
+			}
+		}
+
+		engine := initStorage()
+
+		log, err := view.OpenLog(engine, args[0], "commit")
+
+		if err != nil {
+			logrus.Fatalf("diff: %s", err)
+		}
+
+		events, err := view.Diff(log, from, to)
+
+		if err != nil {
+			logrus.Fatalf("diff: %s", err)
+		}
+
+		switch format := viper.GetString("diff_format"); format {
+		case "csv":
+			w := view.NewEventCSVWriter(os.Stdout)
+
+			for _, e := range events {
+				if err = w.Write(e); err != nil {
+					break
+				}
+			}
+
+			if err == nil {
+				err = w.Flush()
+			}
+
+		case "json":
+			b, _ := json.MarshalIndent(events, "", "\t")
+			_, err = fmt.Println(string(b))
+
+		default:
+			err = fmt.Errorf("unknown format %s", format)
+		}
+
+		if err != nil {
+			logrus.Fatalf("diff: %s", err)
+		}
+	},
+}
+
+func init() {
+	flags := diffCmd.Flags()
+
+	addStorageFlags(flags)
+
+	flags.String("from", "", "Time of the state changes are computed from.")
+	flags.String("to", "", "Time of the state changes are computed to. Defaults to now.")
+	flags.String("format", "csv", "Output format of the events. Choices are: csv, json")
+
+	viper.BindPFlag("diff_from", flags.Lookup("from"))
+	viper.BindPFlag("diff_to", flags.Lookup("to"))
+	viper.BindPFlag("diff_format", flags.Lookup("format"))
+}
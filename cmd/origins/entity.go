@@ -0,0 +1,72 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/chop-dbhi/origins"
+	"github.com/chop-dbhi/origins/chrono"
+	"github.com/chop-dbhi/origins/view"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+var entityCmd = &cobra.Command{
+	Use: "entity <domain> <name>",
+
+	Short: "Outputs the current state of an entity.",
+
+	Long: `entity outputs the attributes and values currently asserted about an
+entity as JSON. Values that refer to other entities are followed up to
+the depth.`,
+
+	Run: func(cmd *cobra.Command, args []string) {
+		bindStorageFlags(cmd.Flags())
+
+		if len(args) != 2 {
+			cmd.Usage()
+			os.Exit(1)
+		}
+
+		ident, err := origins.ParseIdent(args[1])
+
+		if err != nil {
+			logrus.Fatalf("entity: %s", err)
+		}
+
+		var asof time.Time
+
+		if s := viper.GetString("entity_asof"); s != "" {
+			if asof, err = chrono.Parse(s); err != nil {
+				logrus.Fatalf("entity: %s", err)
+			}
+		}
+
+		engine := initStorage()
+
+		e, err := view.Entity(engine, args[0], ident, asof, viper.GetInt("entity_depth"))
+
+		if err != nil {
+			logrus.Fatalf("entity: %s", err)
+		}
+
+		b, _ := json.MarshalIndent(e, "", "\t")
+
+		fmt.Println(string(b))
+	},
+}
+
+func init() {
+	flags := entityCmd.Flags()
+
+	addStorageFlags(flags)
+
+	flags.String("asof", "", "Defines the time the state of the entity is read as of.")
+	flags.Int("depth", 0, "Depth referenced entities are followed to.")
+
+	viper.BindPFlag("entity_asof", flags.Lookup("asof"))
+	viper.BindPFlag("entity_depth", flags.Lookup("depth"))
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/chop-dbhi/origins"
+	"github.com/chop-dbhi/origins/chrono"
+	"github.com/chop-dbhi/origins/transactor"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+var exciseCmd = &cobra.Command{
+	Use: "excise <domain> <entity>",
+
+	Short: "Permanently removes facts about an entity.",
+
+	Long: `excise permanently removes the facts about an entity from a domain.
+
+The facts are physically deleted from storage rather than retracted, so they
+can no longer be viewed at any point in time. An audit record of the excision
+is transacted without the excised content.`,
+
+	Run: func(cmd *cobra.Command, args []string) {
+		bindStorageFlags(cmd.Flags())
+
+		if len(args) != 2 {
+			cmd.Usage()
+			os.Exit(1)
+		}
+
+		entity, err := origins.ParseIdent(args[1])
+
+		if err != nil {
+			logrus.Fatalf("excise: %s", err)
+		}
+
+		ex := transactor.Excision{
+			Domain: args[0],
+			Entity: entity,
+		}
+
+		if attr := viper.GetString("excise_attribute"); attr != "" {
+			if ex.Attribute, err = origins.ParseIdent(attr); err != nil {
+				logrus.Fatalf("excise: %s", err)
+			}
+
+			if ex.Attribute.Domain == "" {
+				ex.Attribute.Domain = ex.Domain
+			}
+		}
+
+		if s := viper.GetString("excise_since"); s != "" {
+			if ex.Since, err = chrono.Parse(s); err != nil {
+				logrus.Fatalf("excise: %s", err)
+			}
+		}
+
+		if s := viper.GetString("excise_asof"); s != "" {
+			if ex.Asof, err = chrono.Parse(s); err != nil {
+				logrus.Fatalf("excise: %s", err)
+			}
+		}
+
+		engine := initStorage()
+
+		count, err := transactor.Excise(engine, ex)
+
+		if err != nil {
+			logrus.Fatalf("excise: %s", err)
+		}
+
+		fmt.Fprintf(os.Stderr, "%d facts excised\n", count)
+	},
+}
+
+func init() {
+	flags := exciseCmd.Flags()
+
+	addStorageFlags(flags)
+
+	flags.String("attribute", "", "Only excise facts with this attribute.")
+	flags.String("since", "", "Only excise facts transacted after this time.")
+	flags.String("asof", "", "Only excise facts transacted before this time.")
+
+	viper.BindPFlag("excise_attribute", flags.Lookup("attribute"))
+	viper.BindPFlag("excise_since", flags.Lookup("since"))
+	viper.BindPFlag("excise_asof", flags.Lookup("asof"))
+}
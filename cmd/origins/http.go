@@ -21,9 +21,10 @@ var httpCmd = &cobra.Command{
 		engine := initStorage()
 		host := viper.GetString("http_host")
 		port := viper.GetInt("http_port")
+		token := viper.GetString("http_transact_token")
 		debug := logrus.GetLevel() == logrus.DebugLevel
 
-		http.Serve(engine, host, port, debug)
+		http.Serve(engine, host, port, debug, token)
 	},
 }
 
@@ -34,7 +35,9 @@ func init() {
 
 	flags.String("host", "", "The host the HTTP service will listen on.")
 	flags.Int("port", 49110, "The port the HTTP will bind to.")
+	flags.String("transact-token", "", "Token clients must supply as a bearer token to transact facts. Transacting is disabled if not set.")
 
 	viper.BindPFlag("http_host", flags.Lookup("host"))
 	viper.BindPFlag("http_port", flags.Lookup("port"))
+	viper.BindPFlag("http_transact_token", flags.Lookup("transact-token"))
 }
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/chop-dbhi/origins/transactor"
+	"github.com/spf13/cobra"
+)
+
+// setReadOnly returns the run function of a command that sets the read-only
+// flag of the domain passed as the argument.
+func setReadOnly(name string, readOnly bool) func(*cobra.Command, []string) {
+	return func(cmd *cobra.Command, args []string) {
+		if len(args) != 1 {
+			cmd.Usage()
+			return
+		}
+
+		bindStorageFlags(cmd.Flags())
+
+		engine := initStorage()
+
+		tx, err := transactor.SetReadOnly(engine, args[0], readOnly)
+
+		if err != nil {
+			logrus.Fatalf("%s: %s", name, err)
+		}
+
+		fmt.Printf("%s: domain %s read-only=%t (transaction %d)\n", name, args[0], readOnly, tx.ID)
+	}
+}
+
+var lockCmd = &cobra.Command{
+	Use: "lock <domain>",
+
+	Short: "Flags a domain as read-only.",
+
+	Long: `lock flags a domain as read-only. Transactions that write to the domain
+fail until it is unlocked.`,
+
+	Run: setReadOnly("lock", true),
+}
+
+var unlockCmd = &cobra.Command{
+	Use: "unlock <domain>",
+
+	Short: "Flags a read-only domain as writable.",
+
+	Run: setReadOnly("unlock", false),
+}
+
+func init() {
+	addStorageFlags(lockCmd.Flags())
+	addStorageFlags(unlockCmd.Flags())
+}
@@ -4,7 +4,6 @@ import (
 	"fmt"
 	"io"
 	"os"
-	"time"
 
 	"github.com/Sirupsen/logrus"
 	"github.com/chop-dbhi/origins"
@@ -15,7 +14,7 @@ import (
 	"github.com/spf13/viper"
 )
 
-func concatDomains(engine storage.Engine, w origins.Writer, domains []string, since, asof time.Time) int {
+func concatDomains(engine storage.Engine, w origins.Writer, domains []string, options view.Options) int {
 	var (
 		err      error
 		n, count int
@@ -30,7 +29,11 @@ func concatDomains(engine storage.Engine, w origins.Writer, domains []string, si
 			logrus.Fatal(err)
 		}
 
-		v := log.View(since, asof)
+		v := log.Read(options)
+
+		if viper.GetBool("log_state") {
+			v = view.State(v)
+		}
 
 		n, err = origins.Copy(v, w)
 
@@ -44,7 +47,7 @@ func concatDomains(engine storage.Engine, w origins.Writer, domains []string, si
 	return count
 }
 
-func mergeDomains(engine storage.Engine, w origins.Writer, domains []string, since, asof time.Time) int {
+func mergeDomains(engine storage.Engine, w origins.Writer, domains []string, options view.Options) int {
 	var (
 		err   error
 		count int
@@ -61,10 +64,22 @@ func mergeDomains(engine storage.Engine, w origins.Writer, domains []string, sin
 			logrus.Fatal(err)
 		}
 
-		iters[i] = log.View(since, asof)
+		iters[i] = log.Read(options)
+	}
+
+	var iter origins.Iterator
+
+	if options.Forward {
+		iter = view.MergeAscending(iters...)
+	} else {
+		iter = view.Merge(iters...)
+	}
+
+	if viper.GetBool("log_state") {
+		iter = view.State(iter)
 	}
 
-	if count, err = origins.Copy(view.Merge(iters...), w); err != nil {
+	if count, err = origins.Copy(iter, w); err != nil {
 		logrus.Fatal(err)
 	}
 
@@ -85,17 +100,22 @@ var logCmd = &cobra.Command{
 		}
 
 		var (
-			w           io.Writer
-			fw          origins.Writer
-			asof, since time.Time
+			w       io.Writer
+			fw      origins.Writer
+			options view.Options
 
 			domains = args
 			file    = viper.GetString("log_file")
 			format  = viper.GetString("log_format")
 		)
 
-		since, _ = chrono.Parse(viper.GetString("log_since"))
-		asof, _ = chrono.Parse(viper.GetString("log_asof"))
+		options.Since, _ = chrono.Parse(viper.GetString("log_since"))
+		options.Asof, _ = chrono.Parse(viper.GetString("log_asof"))
+		options.ValidSince, _ = chrono.Parse(viper.GetString("log_valid_since"))
+		options.ValidAsof, _ = chrono.Parse(viper.GetString("log_valid_asof"))
+		options.SinceTx = uint64(viper.GetInt64("log_since_tx"))
+		options.AsofTx = uint64(viper.GetInt64("log_asof_tx"))
+		options.Forward = viper.GetBool("log_forward")
 
 		engine := initStorage()
 
@@ -125,9 +145,9 @@ var logCmd = &cobra.Command{
 		var count int
 
 		if viper.GetBool("log_merge") {
-			count = mergeDomains(engine, fw, domains, since, asof)
+			count = mergeDomains(engine, fw, domains, options)
 		} else {
-			count = concatDomains(engine, fw, domains, since, asof)
+			count = concatDomains(engine, fw, domains, options)
 		}
 
 		fmt.Fprintf(os.Stderr, "%d facts\n", count)
@@ -144,10 +164,27 @@ func init() {
 	flags.String("file", "", "Path to a file to write the log to.")
 	flags.String("format", "csv", "The output format of the log.")
 	flags.Bool("merge", false, "Multiple domains will be merged.")
+	flags.Bool("state", false, "Only the facts asserted as of the upper time boundary will be output.")
 
 	viper.BindPFlag("log_asof", flags.Lookup("asof"))
 	viper.BindPFlag("log_since", flags.Lookup("since"))
 	viper.BindPFlag("log_file", flags.Lookup("file"))
 	viper.BindPFlag("log_format", flags.Lookup("format"))
 	viper.BindPFlag("log_merge", flags.Lookup("merge"))
+	viper.BindPFlag("log_state", flags.Lookup("state"))
+
+	flags.String("valid-asof", "", "Defines the upper boundary of the valid time of facts to be read. Facts without a valid time are valid from the time they were transacted.")
+	flags.String("valid-since", "", "Defines the lower boundary of the valid time of facts to be read.")
+
+	viper.BindPFlag("log_valid_asof", flags.Lookup("valid-asof"))
+	viper.BindPFlag("log_valid_since", flags.Lookup("valid-since"))
+
+	flags.Bool("forward", false, "Facts will be output oldest first in the order they were committed.")
+	viper.BindPFlag("log_forward", flags.Lookup("forward"))
+
+	flags.Uint64("since-tx", 0, "Defines the first transaction of facts to be read.")
+	flags.Uint64("asof-tx", 0, "Defines the last transaction of facts to be read.")
+
+	viper.BindPFlag("log_since_tx", flags.Lookup("since-tx"))
+	viper.BindPFlag("log_asof_tx", flags.Lookup("asof-tx"))
 }
@@ -6,6 +6,7 @@ import (
 	"path/filepath"
 
 	"github.com/Sirupsen/logrus"
+	"github.com/chop-dbhi/origins/transactor"
 	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
 )
@@ -28,9 +29,19 @@ func main() {
 	mainCmd.AddCommand(versionCmd)
 	mainCmd.AddCommand(generateCmd)
 	mainCmd.AddCommand(transactCmd)
+	mainCmd.AddCommand(revertCmd)
+	mainCmd.AddCommand(exciseCmd)
 	mainCmd.AddCommand(logCmd)
+	mainCmd.AddCommand(timelineCmd)
+	mainCmd.AddCommand(diffCmd)
+	mainCmd.AddCommand(tailCmd)
+	mainCmd.AddCommand(entityCmd)
+	mainCmd.AddCommand(queryCmd)
 	mainCmd.AddCommand(httpCmd)
+	mainCmd.AddCommand(transactorCmd)
 	mainCmd.AddCommand(domainsCmd)
+	mainCmd.AddCommand(lockCmd)
+	mainCmd.AddCommand(unlockCmd)
 
 	viper.SetEnvPrefix("ORIGINS")
 	viper.AutomaticEnv()
@@ -49,9 +60,11 @@ func main() {
 
 	flags.String("log", "info", "Level of log messages to emit. Choices are: debug, info, warn, error, fatal, panic.")
 	flags.String("config", "", "Path to config file. Defaults to a origins.{json,yml,yaml} in the current working directory.")
+	flags.StringSlice("allow-env", nil, "Environment variables the env macro may read.")
 
 	viper.BindPFlag("log", flags.Lookup("log"))
 	viper.BindPFlag("config", flags.Lookup("config"))
+	viper.BindPFlag("allow_env", flags.Lookup("allow-env"))
 
 	// Turn on debugging for all commands.
 	mainCmd.ParseFlags(os.Args)
@@ -74,5 +87,7 @@ func main() {
 
 	logrus.SetLevel(level)
 
+	transactor.AllowEnv(viper.GetStringSlice("allow_env")...)
+
 	mainCmd.Execute()
 }
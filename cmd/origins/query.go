@@ -0,0 +1,110 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/chop-dbhi/origins/chrono"
+	"github.com/chop-dbhi/origins/query"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+var queryCmd = &cobra.Command{
+	Use: "query <query>",
+
+	Short: "Outputs the bindings of a query.",
+
+	Long: `query evaluates a Datalog-style query against the current state of the
+domains, or the state within the since and asof bounds, and outputs the
+distinct values bound to the find variables.
+
+	origins query 'find ?p ?x where [?p person/likes ?s] [?s sports/is ?x]'`,
+
+	Run: func(cmd *cobra.Command, args []string) {
+		bindStorageFlags(cmd.Flags())
+
+		if len(args) != 1 {
+			cmd.Usage()
+			os.Exit(1)
+		}
+
+		q, err := query.Parse(args[0])
+
+		if err != nil {
+			logrus.Fatalf("query: %s", err)
+		}
+
+		options := query.Options{
+			DefaultDomain: viper.GetString("query_domain"),
+		}
+
+		if s := viper.GetString("query_since"); s != "" {
+			if options.Since, err = chrono.Parse(s); err != nil {
+				logrus.Fatalf("query: %s", err)
+			}
+		}
+
+		if s := viper.GetString("query_asof"); s != "" {
+			if options.Asof, err = chrono.Parse(s); err != nil {
+				logrus.Fatalf("query: %s", err)
+			}
+		}
+
+		if s := viper.GetString("query_valid_since"); s != "" {
+			if options.ValidSince, err = chrono.Parse(s); err != nil {
+				logrus.Fatalf("query: %s", err)
+			}
+		}
+
+		if s := viper.GetString("query_valid_asof"); s != "" {
+			if options.ValidAsof, err = chrono.Parse(s); err != nil {
+				logrus.Fatalf("query: %s", err)
+			}
+		}
+
+		engine := initStorage()
+
+		r, err := query.Run(engine, q, options)
+
+		if err != nil {
+			logrus.Fatalf("query: %s", err)
+		}
+
+		switch format := viper.GetString("query_format"); format {
+		case "csv":
+			err = r.WriteCSV(os.Stdout)
+		case "json":
+			b, _ := json.MarshalIndent(r, "", "\t")
+			_, err = fmt.Println(string(b))
+		default:
+			err = fmt.Errorf("unknown format %s", format)
+		}
+
+		if err != nil {
+			logrus.Fatalf("query: %s", err)
+		}
+	},
+}
+
+func init() {
+	flags := queryCmd.Flags()
+
+	addStorageFlags(flags)
+
+	flags.String("domain", "", "Default domain of clauses whose domain is not qualified.")
+	flags.String("since", "", "Defines the lower time boundary of the facts matched.")
+	flags.String("asof", "", "Defines the upper time boundary of the facts matched.")
+	flags.String("valid-since", "", "Defines the lower boundary of the valid time of the facts matched.")
+	flags.String("valid-asof", "", "Defines the upper boundary of the valid time of the facts matched.")
+	flags.String("format", "csv", "Output format of the bindings. Choices are: csv, json")
+
+	viper.BindPFlag("query_domain", flags.Lookup("domain"))
+	viper.BindPFlag("query_since", flags.Lookup("since"))
+	viper.BindPFlag("query_asof", flags.Lookup("asof"))
+	viper.BindPFlag("query_valid_since", flags.Lookup("valid-since"))
+	viper.BindPFlag("query_valid_asof", flags.Lookup("valid-asof"))
+	viper.BindPFlag("query_format", flags.Lookup("format"))
+}
@@ -0,0 +1,54 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/chop-dbhi/origins/transactor"
+	"github.com/spf13/cobra"
+)
+
+var revertCmd = &cobra.Command{
+	Use: "revert <tx-id>",
+
+	Short: "Reverts a transaction.",
+
+	Long: `revert transacts the inverse of the facts written by a transaction.
+
+Asserted facts are retracted and retracted facts are asserted again. The
+reverting transaction is linked to the original by a reverts fact.`,
+
+	Run: func(cmd *cobra.Command, args []string) {
+		if len(args) != 1 {
+			cmd.Usage()
+			return
+		}
+
+		id, err := strconv.ParseUint(args[0], 10, 64)
+
+		if err != nil {
+			logrus.Fatalf("revert: invalid transaction id %s", args[0])
+		}
+
+		bindStorageFlags(cmd.Flags())
+
+		engine := initStorage()
+
+		tx, err := transactor.Revert(engine, id)
+
+		if err != nil {
+			logrus.Fatalf("revert: %s", err)
+		}
+
+		info, _ := json.MarshalIndent(tx.Info(), "", "\t")
+
+		fmt.Println(string(info))
+	},
+}
+
+func init() {
+	flags := revertCmd.Flags()
+	addStorageFlags(flags)
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/chop-dbhi/origins"
+	"github.com/chop-dbhi/origins/view"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+var tailCmd = &cobra.Command{
+	Use: "tail <domain>",
+
+	Short: "Outputs facts as they are committed to a domain.",
+
+	Long: `tail follows the commit log of a domain and outputs the facts of each
+transaction committed after it starts until it is interrupted.`,
+
+	Run: func(cmd *cobra.Command, args []string) {
+		bindStorageFlags(cmd.Flags())
+
+		if len(args) != 1 {
+			cmd.Usage()
+			os.Exit(1)
+		}
+
+		engine := initStorage()
+
+		sub, err := view.Subscribe(engine, args[0], viper.GetDuration("tail_interval"))
+
+		if err != nil {
+			logrus.Fatalf("tail: %s", err)
+		}
+
+		sig := make(chan os.Signal, 1)
+		signal.Notify(sig, os.Interrupt, syscall.SIGTERM)
+
+		go func() {
+			<-sig
+			sub.Close()
+		}()
+
+		w := origins.NewCSVWriter(os.Stdout)
+
+		for c := range sub.C {
+			logrus.Debugf("tail: transaction %d committed %d facts", c.Transaction, c.Count)
+
+			// The writer is flushed after each commit.
+			if _, err = origins.Copy(c.Facts(), w); err != nil {
+				logrus.Fatalf("tail: %s", err)
+			}
+		}
+
+		if err = sub.Err(); err != nil {
+			logrus.Fatalf("tail: %s", err)
+		}
+	},
+}
+
+func init() {
+	flags := tailCmd.Flags()
+
+	addStorageFlags(flags)
+
+	flags.Duration("interval", view.DefaultPollInterval, "Interval the commit log is checked for new transactions.")
+
+	viper.BindPFlag("tail_interval", flags.Lookup("interval"))
+}
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/chop-dbhi/origins/chrono"
+	"github.com/chop-dbhi/origins/view"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+var timelineCmd = &cobra.Command{
+	Use: "timeline <domain>",
+
+	Short: "Outputs the events derived from the log of a domain.",
+
+	Long: `timeline outputs the add, change and remove events derived from the log
+of a domain, newest first. Events are written as they are derived.`,
+
+	Run: func(cmd *cobra.Command, args []string) {
+		bindStorageFlags(cmd.Flags())
+
+		if len(args) != 1 {
+			cmd.Usage()
+			os.Exit(1)
+		}
+
+		var (
+			err         error
+			since, asof time.Time
+		)
+
+		if s := viper.GetString("timeline_since"); s != "" {
+			if since, err = chrono.Parse(s); err != nil {
+				logrus.Fatalf("timeline: %s", err)
+			}
+		}
+
+		if s := viper.GetString("timeline_asof"); s != "" {
+			if asof, err = chrono.Parse(s); err != nil {
+				logrus.Fatalf("timeline: %s", err)
+			}
+		}
+
+		engine := initStorage()
+
+		log, err := view.OpenLog(engine, args[0], "commit")
+
+		if err != nil {
+			logrus.Fatalf("timeline: %s", err)
+		}
+
+		events := view.NewTimeline(log.View(since, asof), view.Descending)
+
+		switch format := viper.GetString("timeline_format"); format {
+		case "csv":
+			w := view.NewEventCSVWriter(os.Stdout)
+
+			for e := events.Next(); e != nil; e = events.Next() {
+				if err = w.Write(e); err != nil {
+					break
+				}
+			}
+
+			if err == nil {
+				err = w.Flush()
+			}
+
+		// One JSON-encoded event per line.
+		case "json":
+			enc := json.NewEncoder(os.Stdout)
+
+			for e := events.Next(); e != nil; e = events.Next() {
+				if err = enc.Encode(e); err != nil {
+					break
+				}
+			}
+
+		default:
+			err = fmt.Errorf("unknown format %s", format)
+		}
+
+		if err == nil {
+			err = events.Err()
+		}
+
+		if err != nil {
+			logrus.Fatalf("timeline: %s", err)
+		}
+	},
+}
+
+func init() {
+	flags := timelineCmd.Flags()
+
+	addStorageFlags(flags)
+
+	flags.String("since", "", "Defines the lower time boundary of the facts events are derived from.")
+	flags.String("asof", "", "Defines the upper time boundary of the facts events are derived from.")
+	flags.String("format", "csv", "Output format of the events. Choices are: csv, json")
+
+	viper.BindPFlag("timeline_since", flags.Lookup("since"))
+	viper.BindPFlag("timeline_asof", flags.Lookup("asof"))
+	viper.BindPFlag("timeline_format", flags.Lookup("format"))
+}
@@ -6,7 +6,9 @@ import (
 	"io"
 	"os"
 	"os/signal"
+	"sync"
 	"syscall"
+	"time"
 
 	"github.com/Sirupsen/logrus"
 	"github.com/chop-dbhi/origins"
@@ -42,11 +44,39 @@ func transactFile(tx *transactor.Transaction, r io.Reader, format, compression s
 		logrus.Fatal("transact: unsupported file format", format)
 	}
 
+	// Cancel the transaction so the written blocks are removed before exiting.
 	if _, err = origins.Copy(iter, tx); err != nil {
-		logrus.Fatal("transact:", err)
+		tx.Cancel()
+		logrus.Fatal("transact: ", err)
 	}
 }
 
+// writePreview writes the facts and events of a previewed transaction to stdout.
+func writePreview(tx *transactor.Transaction, format string) error {
+	pv, err := tx.Preview()
+
+	if err != nil {
+		return err
+	}
+
+	switch format {
+	case "csv":
+		return pv.WriteCSV(os.Stdout)
+	case "json":
+		b, err := json.MarshalIndent(pv, "", "\t")
+
+		if err != nil {
+			return err
+		}
+
+		_, err = fmt.Println(string(b))
+
+		return err
+	}
+
+	return fmt.Errorf("unknown format %s", format)
+}
+
 var transactCmd = &cobra.Command{
 	Use: "transact [path, ...]",
 
@@ -63,10 +93,55 @@ var transactCmd = &cobra.Command{
 		compression := viper.GetString("transact_compression")
 		domain := viper.GetString("transact_domain")
 		fake := viper.GetBool("transact_fake")
+		preview := viper.GetBool("transact_preview")
 
-		tx, err := transactor.New(engine, transactor.Options{
-			DefaultDomain: domain,
-		})
+		meta, err := transactor.ParseMeta(viper.GetStringSlice("transact_meta"))
+
+		if err != nil {
+			logrus.Fatal("transact: ", err)
+		}
+
+		options := transactor.Options{
+			DefaultDomain:  domain,
+			Meta:           meta,
+			Preview:        preview,
+			IdempotencyKey: viper.GetString("transact_idempotency_key"),
+			MaxFacts:       viper.GetInt("transact_max_facts"),
+			MaxBytes:       viper.GetInt("transact_max_bytes"),
+			MaxDomains:     viper.GetInt("transact_max_domains"),
+			MaxDuration:    viper.GetDuration("transact_max_duration"),
+			BulkLoad:       viper.GetBool("transact_bulk"),
+			BulkWorkers:    viper.GetInt("transact_bulk_workers"),
+			Privileged:     viper.GetBool("transact_privileged"),
+		}
+
+		// Report the progress of the transaction at each interval and as
+		// blocks are flushed. Reports closer than half an interval to the
+		// previous one are skipped, so flushes do not flood the output
+		// while the reports at each interval are still written.
+		if interval := viper.GetDuration("transact_progress"); interval > 0 {
+			var (
+				mu   sync.Mutex
+				last = time.Now()
+			)
+
+			options.ProgressInterval = interval
+
+			options.OnProgress = func(p *transactor.Progress) {
+				mu.Lock()
+				defer mu.Unlock()
+
+				if time.Since(last) < interval/2 {
+					return
+				}
+
+				last = time.Now()
+
+				fmt.Fprintf(os.Stderr, "transact: %s\n", p)
+			}
+		}
+
+		tx, err := transactor.New(engine, options)
 
 		if err != nil {
 			logrus.Fatal("transact: error starting transaction:", err)
@@ -128,6 +203,14 @@ var transactCmd = &cobra.Command{
 			logrus.Fatalf("transact: %s", err)
 		}
 
+		if preview {
+			if err = writePreview(tx, viper.GetString("transact_preview_format")); err != nil {
+				logrus.Fatalf("transact: %s", err)
+			}
+
+			return
+		}
+
 		info, _ := json.MarshalIndent(tx.Info(), "", "\t")
 
 		fmt.Println(string(info))
@@ -143,9 +226,40 @@ func init() {
 	flags.String("compression", "", "Compression method of the stream of facts. Choices are: bzip2, gzip")
 	flags.String("domain", "", "Default domain to transact the facts to. If not supplied, the fact domain attribute must be defined.")
 	flags.Bool("fake", false, "If set, the transaction will not be committed.")
+	flags.Bool("preview", false, "If set, the transaction is aborted and the facts and events it would cause are output.")
+	flags.String("preview-format", "json", "Output format of the preview. Choices are: csv, json")
+	flags.StringSlice("meta", nil, "Metadata about the transaction as key=value pairs, such as author=jdoe. May be repeated.")
+	flags.String("idempotency-key", "", "Key that uniquely identifies the transaction. If a transaction with the same key was already committed, its info is output and nothing is written.")
 
 	viper.BindPFlag("transact_format", flags.Lookup("format"))
 	viper.BindPFlag("transact_compression", flags.Lookup("compression"))
 	viper.BindPFlag("transact_domain", flags.Lookup("domain"))
 	viper.BindPFlag("transact_fake", flags.Lookup("fake"))
+	viper.BindPFlag("transact_meta", flags.Lookup("meta"))
+	viper.BindPFlag("transact_preview", flags.Lookup("preview"))
+	viper.BindPFlag("transact_preview_format", flags.Lookup("preview-format"))
+	viper.BindPFlag("transact_idempotency_key", flags.Lookup("idempotency-key"))
+
+	flags.Duration("progress", 5*time.Second, "Interval the progress of the transaction is reported on stderr. Zero disables reporting.")
+	viper.BindPFlag("transact_progress", flags.Lookup("progress"))
+
+	// Limits may also be set in the config file, e.g. transact_max_facts.
+	flags.Int("max-facts", 0, "Maximum number of facts the transaction may receive. Zero means no limit.")
+	flags.Int("max-bytes", 0, "Maximum number of bytes the transaction may write. Zero means no limit.")
+	flags.Int("max-domains", 0, "Maximum number of domains the transaction may write to. Zero means no limit.")
+	flags.Duration("max-duration", 0, "Maximum duration of the transaction, such as 10m. Zero means no limit.")
+
+	viper.BindPFlag("transact_max_facts", flags.Lookup("max-facts"))
+	viper.BindPFlag("transact_max_bytes", flags.Lookup("max-bytes"))
+	viper.BindPFlag("transact_max_domains", flags.Lookup("max-domains"))
+	viper.BindPFlag("transact_max_duration", flags.Lookup("max-duration"))
+
+	flags.Bool("bulk", false, "Load the facts into new domains in bulk. Facts are not deduplicated.")
+	flags.Int("bulk-workers", 0, "Number of workers encoding facts in bulk mode. Defaults to the number of CPUs.")
+
+	viper.BindPFlag("transact_bulk", flags.Lookup("bulk"))
+	viper.BindPFlag("transact_bulk_workers", flags.Lookup("bulk-workers"))
+
+	flags.Bool("privileged", false, "Allow facts to be written to the reserved origins.* domains.")
+	viper.BindPFlag("transact_privileged", flags.Lookup("privileged"))
 }
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"os"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/chop-dbhi/origins/http"
+	"github.com/chop-dbhi/origins/transactor"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+var transactorCmd = &cobra.Command{
+	Use: "transactor",
+
+	Short: "Starts a transactor service.",
+
+	Long: `Runs a process that owns the storage engine and transacts the fact
+streams submitted to it over a Unix socket or HTTP.
+
+Submitted streams are queued. Transactions to the same domain are committed
+one at a time in the order they were submitted, while transactions to
+different domains run in parallel.`,
+
+	Run: func(cmd *cobra.Command, args []string) {
+		bindStorageFlags(cmd.Flags())
+
+		engine := initStorage()
+		socket := viper.GetString("transactor_socket")
+		debug := logrus.GetLevel() == logrus.DebugLevel
+
+		var (
+			l   net.Listener
+			err error
+		)
+
+		if socket != "" {
+			// Remove a socket left behind by a previous process.
+			os.Remove(socket)
+
+			l, err = net.Listen("unix", socket)
+		} else {
+			l, err = net.Listen("tcp", fmt.Sprintf("%s:%d", viper.GetString("transactor_host"), viper.GetInt("transactor_port")))
+		}
+
+		if err != nil {
+			logrus.Fatal("transactor: ", err)
+		}
+
+		defer l.Close()
+
+		queue := transactor.NewQueue(engine)
+		queue.MaxFacts = viper.GetInt("transactor_max_facts")
+
+		if err = http.ServeTransactor(queue, l, debug); err != nil {
+			logrus.Fatal("transactor: ", err)
+		}
+	},
+}
+
+func init() {
+	flags := transactorCmd.Flags()
+
+	addStorageFlags(flags)
+
+	flags.String("socket", "", "Path to a Unix socket to listen on. If not supplied, the service listens on the host and port.")
+	flags.String("host", "localhost", "The host the service will listen on.")
+	flags.Int("port", 49111, "The port the service will bind to.")
+	flags.Int("max-facts", 1000000, "Maximum number of facts in a submitted stream. Streams are held in memory until they are transacted.")
+
+	viper.BindPFlag("transactor_socket", flags.Lookup("socket"))
+	viper.BindPFlag("transactor_host", flags.Lookup("host"))
+	viper.BindPFlag("transactor_port", flags.Lookup("port"))
+	viper.BindPFlag("transactor_max_facts", flags.Lookup("max-facts"))
+}
@@ -3,7 +3,7 @@
 // The following fields are supported:
 //
 // - Domain - The domain the fact will be asserted in. This is only required for bulk-formatted data, otherwise it is ignored.
-// - Operation - The operation to apply to this fact. Optional, defaults to "assert".
+// - Operation - The operation to apply to this fact. Optional, defaults to "assert". The "retract-entity" operation retracts all currently asserted facts about the entity, in which case the attribute and value are ignored.
 // - Valid Time - The time this fact should be considered valid. This is separate from the "database time" which denotes when the fact was physically added. Optional, defaults to "now".
 // - Entity Domain - The domain of the entity. Optional, defaults to the fact domain.
 // - Entity - The local name of the attribute.
@@ -111,6 +111,9 @@ func isEmptyRecord(r []string) bool {
 	return true
 }
 
+// Operation that retracts all currently asserted facts about an entity.
+const retractEntityOperation = "retract-entity"
+
 type CSVReader struct {
 	reader *csv.Reader
 	header map[string]int
@@ -127,6 +130,8 @@ func (r *CSVReader) parse(record []string) (*Fact, error) {
 		val       string
 		dom       string
 		f         = Fact{}
+
+		retractEntity bool
 	)
 
 	rlen = len(record)
@@ -138,7 +143,15 @@ func (r *CSVReader) parse(record []string) (*Fact, error) {
 
 	// Operation
 	if idx, ok = r.header["operation"]; ok && idx < rlen {
-		op, err := ParseOperation(record[idx])
+		val = record[idx]
+
+		// Shorthand for retracting the entity macro attribute.
+		if strings.ToLower(val) == retractEntityOperation {
+			retractEntity = true
+			val = "retract"
+		}
+
+		op, err := ParseOperation(val)
 
 		if err != nil {
 			logrus.Error(err)
@@ -198,6 +211,14 @@ func (r *CSVReader) parse(record []string) (*Fact, error) {
 
 	f.Attribute = ident
 
+	// The attribute is ignored when retracting the entity.
+	if retractEntity {
+		f.Attribute = &Ident{
+			Domain: MacrosDomain,
+			Name:   EntityMacro,
+		}
+	}
+
 	// Value
 	idx, _ = r.header["value"]
 	val = record[idx]
@@ -56,6 +56,9 @@ func TestSegmentMethods(t *testing.T) {
 		Bytes:       460800,
 		Next:        &next,
 		Base:        &next,
+
+		MaxTransaction: 12,
+		MaxTime:        now.Add(time.Second),
 	}
 
 	_, err := SetSegment(engine, "testing", &s)
@@ -72,6 +75,8 @@ func TestSegmentMethods(t *testing.T) {
 
 	assert.Equal(t, s.Transaction, s2.Transaction)
 	assert.Equal(t, *s.Next, *s2.Next)
+	assert.Equal(t, s.MaxTransaction, s2.MaxTransaction)
+	assert.True(t, s.MaxTime.Equal(s2.MaxTime))
 }
 
 func TestBlockMethods(t *testing.T) {
@@ -123,6 +128,65 @@ func TestBlockMethods(t *testing.T) {
 	}
 }
 
+func TestStateMethods(t *testing.T) {
+	engine, _ := origins.Init("memory", nil)
+
+	entity := &origins.Ident{
+		Domain: "testing",
+		Name:   "field",
+	}
+
+	facts := origins.Facts{
+		{
+			Domain:      "testing",
+			Operation:   origins.Assertion,
+			Transaction: 5,
+			Time:        chrono.Norm(time.Now()),
+			Entity:      entity,
+			Attribute: &origins.Ident{
+				Domain: "testing",
+				Name:   "dataType",
+			},
+			Value: &origins.Ident{
+				Name: "string",
+			},
+		},
+		{
+			Domain:      "testing",
+			Operation:   origins.Retraction,
+			Transaction: 8,
+			Entity:      entity,
+			Attribute: &origins.Ident{
+				Domain: "testing",
+				Name:   "label",
+			},
+			Value: &origins.Ident{
+				Name: "Field",
+			},
+		},
+	}
+
+	if _, err := SetState(engine, "testing", entity, facts); err != nil {
+		t.Fatal(err)
+	}
+
+	facts2, err := GetState(engine, "testing", entity)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assert.Equal(t, facts, facts2)
+
+	if err = DeleteState(engine, "testing", entity); err != nil {
+		t.Fatal(err)
+	}
+
+	facts2, _ = GetState(engine, "testing", entity)
+
+	assert.Nil(t, facts2)
+}
+
 func BenchmarkSetLog(b *testing.B) {
 	engine, _ := origins.Init("memory", nil)
 
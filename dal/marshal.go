@@ -86,6 +86,11 @@ func marshalSegment(s *Segment) ([]byte, error) {
 		Base:        encodeUUID(s.Base),
 	}
 
+	if s.MaxTransaction > 0 {
+		m.MaxTransaction = proto.Uint64(s.MaxTransaction)
+		m.MaxTime = proto.Int64(chrono.TimeMicro(s.MaxTime))
+	}
+
 	return proto.Marshal(&m)
 }
 
@@ -105,10 +110,22 @@ func unmarshalSegment(b []byte, s *Segment) error {
 	s.Next = decodeUUID(m.GetNext())
 	s.Base = decodeUUID(m.GetBase())
 
+	if m.MaxTransaction != nil {
+		s.MaxTransaction = m.GetMaxTransaction()
+		s.MaxTime = chrono.MicroTime(m.GetMaxTime())
+	}
+
 	return nil
 }
 
 func marshalFact(m *ProtoFact, f *origins.Fact) ([]byte, error) {
+	encodeFact(m, f)
+
+	return proto.Marshal(m)
+}
+
+// encodeFact sets the fields of the protobuf message from the fact.
+func encodeFact(m *ProtoFact, f *origins.Fact) {
 	m.Reset()
 
 	m.EntityDomain = proto.String(f.Entity.Domain)
@@ -130,8 +147,6 @@ func marshalFact(m *ProtoFact, f *origins.Fact) ([]byte, error) {
 	default:
 		panic("fact: invalid op")
 	}
-
-	return proto.Marshal(m)
 }
 
 // unmarshalFact decodes a fact from it's binary representation. The domain and
@@ -147,6 +162,11 @@ func unmarshalFact(m *ProtoFact, b []byte, d string, t uint64, f *origins.Fact)
 	f.Domain = d
 	f.Transaction = t
 
+	// Facts stored outside of a segment carry their own transaction.
+	if m.Transaction != nil {
+		f.Transaction = m.GetTransaction()
+	}
+
 	f.Entity = &origins.Ident{
 		Domain: m.GetEntityDomain(),
 		Name:   m.GetEntity(),
@@ -177,6 +197,10 @@ func unmarshalFact(m *ProtoFact, b []byte, d string, t uint64, f *origins.Fact)
 type BlockEncoder struct {
 	Count int
 
+	// If true, the transaction ID of the fact is encoded. This is
+	// not necessary for blocks stored relative to a segment.
+	transactions bool
+
 	// Shared buffer for encoding the fact prefix.
 	prefix []byte
 
@@ -189,7 +213,13 @@ type BlockEncoder struct {
 
 // Write encodes a fact and writes to the block.
 func (e *BlockEncoder) Write(f *origins.Fact) error {
-	data, err := marshalFact(e.proto, f)
+	encodeFact(e.proto, f)
+
+	if e.transactions && f.Transaction > 0 {
+		e.proto.Transaction = proto.Uint64(f.Transaction)
+	}
+
+	data, err := proto.Marshal(e.proto)
 
 	if err != nil {
 		return err
@@ -234,6 +264,26 @@ func NewBlockEncoder() *BlockEncoder {
 	}
 }
 
+// marshalState encodes the current state of an entity. Unlike blocks, the
+// facts originate from different transactions so the IDs are encoded with them.
+func marshalState(facts origins.Facts) ([]byte, error) {
+	e := NewBlockEncoder()
+	e.transactions = true
+
+	for _, f := range facts {
+		if err := e.Write(f); err != nil {
+			return nil, err
+		}
+	}
+
+	return e.Bytes(), nil
+}
+
+// unmarshalState decodes the current state of an entity.
+func unmarshalState(b []byte, domain string) (origins.Facts, error) {
+	return origins.ReadAll(NewBlockDecoder(b, domain, 0))
+}
+
 // BlockDecoder decodes bytes into facts.
 type BlockDecoder struct {
 	Domain      string
@@ -3,6 +3,7 @@ package dal
 import (
 	"fmt"
 
+	"github.com/chop-dbhi/origins"
 	"github.com/chop-dbhi/origins/storage"
 	"github.com/satori/go.uuid"
 )
@@ -17,6 +18,10 @@ const (
 	// Blocks are keyed by the segment UUID they belong to and block index.
 	// They are stored in a domain.
 	blockKey = "block.%s.%d"
+
+	// Current-state index entries are keyed by the entity identity. They
+	// are stored in a domain.
+	stateKey = "state.%s"
 )
 
 func GetLog(e storage.Tx, domain, name string) (*Log, error) {
@@ -146,3 +151,48 @@ func DeleteBlock(e storage.Tx, domain string, id *uuid.UUID, idx int) error {
 
 	return e.Delete(domain, key)
 }
+
+// GetState returns the most recent fact about each attribute/value pair of
+// the entity from the current-state index of the domain.
+func GetState(e storage.Tx, domain string, entity *origins.Ident) (origins.Facts, error) {
+	var (
+		bytes []byte
+		err   error
+		key   string
+	)
+
+	key = fmt.Sprintf(stateKey, entity)
+
+	if bytes, err = e.Get(domain, key); err != nil {
+		return nil, err
+	}
+
+	if bytes == nil {
+		return nil, nil
+	}
+
+	return unmarshalState(bytes, domain)
+}
+
+// SetState writes the state of the entity to the current-state index of the domain.
+func SetState(e storage.Tx, domain string, entity *origins.Ident, facts origins.Facts) (int, error) {
+	var (
+		bytes []byte
+		err   error
+		key   string
+	)
+
+	if bytes, err = marshalState(facts); err != nil {
+		return 0, err
+	}
+
+	key = fmt.Sprintf(stateKey, entity)
+
+	return len(bytes), e.Set(domain, key, bytes)
+}
+
+func DeleteState(e storage.Tx, domain string, entity *origins.Ident) error {
+	key := fmt.Sprintf(stateKey, entity)
+
+	return e.Delete(domain, key)
+}
@@ -55,6 +55,8 @@ type ProtoSegment struct {
 	Bytes            *int32  `protobuf:"varint,6,req" json:"Bytes,omitempty"`
 	Next             []byte  `protobuf:"bytes,7,opt" json:"Next,omitempty"`
 	Base             []byte  `protobuf:"bytes,8,opt" json:"Base,omitempty"`
+	MaxTransaction   *uint64 `protobuf:"varint,9,opt" json:"MaxTransaction,omitempty"`
+	MaxTime          *int64  `protobuf:"varint,10,opt" json:"MaxTime,omitempty"`
 	XXX_unrecognized []byte  `json:"-"`
 }
 
@@ -118,6 +120,20 @@ func (m *ProtoSegment) GetBase() []byte {
 	return nil
 }
 
+func (m *ProtoSegment) GetMaxTransaction() uint64 {
+	if m != nil && m.MaxTransaction != nil {
+		return *m.MaxTransaction
+	}
+	return 0
+}
+
+func (m *ProtoSegment) GetMaxTime() int64 {
+	if m != nil && m.MaxTime != nil {
+		return *m.MaxTime
+	}
+	return 0
+}
+
 // Facts do not contain omit the domain and transaction ID since this info
 // is contained in the tiers accessed above the fact. Specifically, the domain
 // is required to access the fact, so it is attached to the fact when decoded.
@@ -133,6 +149,7 @@ type ProtoFact struct {
 	ValueDomain      *string `protobuf:"bytes,6,opt" json:"ValueDomain,omitempty"`
 	Value            *string `protobuf:"bytes,7,req" json:"Value,omitempty"`
 	Time             *int64  `protobuf:"varint,8,opt" json:"Time,omitempty"`
+	Transaction      *uint64 `protobuf:"varint,9,opt" json:"Transaction,omitempty"`
 	XXX_unrecognized []byte  `json:"-"`
 }
 
@@ -196,5 +213,12 @@ func (m *ProtoFact) GetTime() int64 {
 	return 0
 }
 
+func (m *ProtoFact) GetTransaction() uint64 {
+	if m != nil && m.Transaction != nil {
+		return *m.Transaction
+	}
+	return 0
+}
+
 func init() {
 }
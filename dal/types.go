@@ -52,4 +52,11 @@ type Segment struct {
 	// the same value as Base, except when a conflict is resolved and
 	// the segment position is changed.
 	Next *uuid.UUID
+
+	// Greatest transaction and latest time of this segment and every
+	// segment it succeeds. These never decrease towards the head of the
+	// log. They are zero if any of the segments was committed before the
+	// bounds were recorded.
+	MaxTransaction uint64
+	MaxTime        time.Time
 }
@@ -4,7 +4,13 @@ const (
 	AttrsDomain         = "origins.attrs"
 	TypesDomain         = "origins.types"
 	MacrosDomain        = "origins.macros"
+	TempidsDomain       = "origins.tempids"
 	DomainsDomain       = "origins.domains"
 	TransactionsDomain  = "origins.transactions"
 	CardinalitiesDomain = "origins.cardinalities"
 )
+
+// EntityMacro is the name of the attribute in the macros domain that denotes
+// the fact applies to the entity as a whole. Retracting it retracts all
+// currently asserted facts about the entity.
+const EntityMacro = "entity"
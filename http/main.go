@@ -1,13 +1,19 @@
 package http
 
 import (
+	"crypto/subtle"
 	"encoding/json"
 	"fmt"
 	"net/http"
+	"strconv"
+	"time"
 
 	"github.com/Sirupsen/logrus"
 	"github.com/chop-dbhi/origins"
+	"github.com/chop-dbhi/origins/chrono"
+	"github.com/chop-dbhi/origins/query"
 	"github.com/chop-dbhi/origins/storage"
+	"github.com/chop-dbhi/origins/transactor"
 	"github.com/chop-dbhi/origins/view"
 	"github.com/labstack/echo"
 	mw "github.com/labstack/echo/middleware"
@@ -15,7 +21,15 @@ import (
 
 const StatusUnprocessableEntity = 422
 
-func Serve(engine storage.Engine, host string, port int, debug bool) {
+// Header for supplying transaction metadata as key=value pairs.
+const metaHeader = "X-Origins-Meta"
+
+// Header for supplying a key that uniquely identifies a transaction.
+const idempotencyHeader = "Idempotency-Key"
+
+// Serve runs the HTTP service. The transact endpoint is only enabled if a
+// token is supplied, which clients must present as a bearer token.
+func Serve(engine storage.Engine, host string, port int, debug bool, token string) {
 	e := echo.New()
 
 	e.HTTP2(true)
@@ -41,6 +55,18 @@ func Serve(engine storage.Engine, host string, port int, debug bool) {
 
 	e.Get("/timeline/:domain", httpTimeline)
 
+	e.Get("/diff/:domain", httpDiff)
+
+	e.Get("/state/:domain", httpState)
+
+	e.Get("/entity/:domain/:name", httpEntity)
+
+	e.Get("/query", httpQuery)
+
+	if token != "" {
+		e.Post("/transact", requireToken(token, httpTransact))
+	}
+
 	// Serve it up.
 	addr := fmt.Sprintf("%s:%d", host, port)
 
@@ -119,6 +145,8 @@ func httpLog(c *echo.Context) error {
 	return json.NewEncoder(w).Encode(facts)
 }
 
+// httpTimeline streams the events derived from the log of the domain as they
+// are read rather than buffering the timeline.
 func httpTimeline(c *echo.Context) error {
 	r := c.Request()
 	w := c.Response()
@@ -134,15 +162,261 @@ func httpTimeline(c *echo.Context) error {
 		})
 	}
 
-	events, err := view.Timeline(iter, view.Descending)
+	events := view.NewTimeline(iter, view.Descending)
+
+	if detectFormat(w, r) == "csv" {
+		err = streamEventsCSV(w, events)
+	} else {
+		err = streamEventsJSON(w, events)
+	}
+
+	if err == nil {
+		return nil
+	}
+
+	// The error can only be reported if nothing has been written yet.
+	if !w.Committed() {
+		return c.JSON(http.StatusInternalServerError, map[string]interface{}{
+			"error": fmt.Sprint(err),
+		})
+	}
+
+	logrus.Errorf("http: error streaming timeline of %s: %s", domain, err)
+
+	return nil
+}
+
+// httpDiff returns the events that turn the state of the domain as of the
+// from query parameter into the state as of the to query parameter.
+func httpDiff(c *echo.Context) error {
+	r := c.Request()
+	w := c.Response()
+	e := c.Get("engine").(storage.Engine)
+
+	var (
+		err      error
+		from, to time.Time
+	)
+
+	q := r.URL.Query()
+
+	if q.Get("from") != "" {
+		if from, err = chrono.Parse(q.Get("from")); err != nil {
+			return c.JSON(StatusUnprocessableEntity, map[string]interface{}{
+				"error": fmt.Sprint(err),
+			})
+		}
+	}
+
+	if q.Get("to") != "" {
+		if to, err = chrono.Parse(q.Get("to")); err != nil {
+			return c.JSON(StatusUnprocessableEntity, map[string]interface{}{
+				"error": fmt.Sprint(err),
+			})
+		}
+	}
+
+	log, err := view.OpenLog(e, c.Param("domain"), "commit")
 
 	if err != nil {
+		code := http.StatusInternalServerError
+
+		if err == view.ErrDoesNotExist {
+			code = http.StatusNotFound
+		}
+
 		return c.JSON(code, map[string]interface{}{
 			"error": fmt.Sprint(err),
 		})
 	}
 
-	return json.NewEncoder(w).Encode(events)
+	events, err := view.Diff(log, from, to)
+
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]interface{}{
+			"error": fmt.Sprint(err),
+		})
+	}
+
+	if detectFormat(w, r) == "csv" {
+		cw := view.NewEventCSVWriter(w)
+
+		for _, ev := range events {
+			if err = cw.Write(ev); err != nil {
+				return err
+			}
+		}
+
+		return cw.Flush()
+	}
+
+	return c.JSON(http.StatusOK, events)
+}
+
+// httpState returns the facts currently asserted in the domain or as of the
+// asof or asof_tx query parameters. The valid_since and valid_asof query
+// parameters bound the valid time of the facts. The offset and limit are
+// applied to the state.
+func httpState(c *echo.Context) error {
+	r := c.Request()
+	w := c.Response()
+	e := c.Get("engine").(storage.Engine)
+
+	domain := c.Param("domain")
+
+	options, err := parseViewParams(r)
+
+	if err != nil {
+		return c.JSON(StatusUnprocessableEntity, map[string]interface{}{
+			"error": fmt.Sprint(err),
+		})
+	}
+
+	// The state is of all facts up to the upper bounds.
+	options.Since = time.Time{}
+	options.SinceTx = 0
+
+	offset, limit, err := parseSliceParams(r)
+
+	if err != nil {
+		return c.JSON(StatusUnprocessableEntity, map[string]interface{}{
+			"error": fmt.Sprint(err),
+		})
+	}
+
+	log, err := view.OpenLog(e, domain, "commit")
+
+	if err != nil {
+		code := http.StatusInternalServerError
+
+		if err == view.ErrDoesNotExist {
+			code = http.StatusNotFound
+		}
+
+		return c.JSON(code, map[string]interface{}{
+			"error": fmt.Sprint(err),
+		})
+	}
+
+	iter := view.State(log.Read(options))
+
+	if offset > 0 || limit > 0 {
+		iter = origins.Slice(iter, offset, limit)
+	}
+
+	facts, err := origins.ReadAll(iter)
+
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]interface{}{
+			"error": fmt.Sprint(err),
+		})
+	}
+
+	return json.NewEncoder(w).Encode(facts)
+}
+
+// httpEntity returns the state of the entity as of the asof query parameter.
+// The depth query parameter sets the depth referenced entities are followed to.
+func httpEntity(c *echo.Context) error {
+	r := c.Request()
+	e := c.Get("engine").(storage.Engine)
+
+	_, asof, err := parseTimeParams(r)
+
+	if err != nil {
+		return c.JSON(StatusUnprocessableEntity, map[string]interface{}{
+			"error": fmt.Sprint(err),
+		})
+	}
+
+	var depth int
+
+	if s := r.URL.Query().Get("depth"); s != "" {
+		if depth, err = strconv.Atoi(s); err != nil {
+			return c.JSON(StatusUnprocessableEntity, map[string]interface{}{
+				"error": fmt.Sprint(err),
+			})
+		}
+	}
+
+	ident := &origins.Ident{
+		Name: c.Param("name"),
+	}
+
+	entity, err := view.Entity(e, c.Param("domain"), ident, asof, depth)
+
+	if err != nil {
+		code := http.StatusInternalServerError
+
+		if err == view.ErrDoesNotExist || err == view.ErrNoEntity {
+			code = http.StatusNotFound
+		}
+
+		return c.JSON(code, map[string]interface{}{
+			"error": fmt.Sprint(err),
+		})
+	}
+
+	return c.JSON(http.StatusOK, entity)
+}
+
+// httpQuery evaluates the query in the q query parameter. The domain query
+// parameter is the default domain of the clauses and the since, asof,
+// valid_since and valid_asof query parameters bound the facts.
+func httpQuery(c *echo.Context) error {
+	r := c.Request()
+	w := c.Response()
+	e := c.Get("engine").(storage.Engine)
+
+	q, err := query.Parse(r.URL.Query().Get("q"))
+
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]interface{}{
+			"error": fmt.Sprint(err),
+		})
+	}
+
+	since, asof, err := parseTimeParams(r)
+
+	if err != nil {
+		return c.JSON(StatusUnprocessableEntity, map[string]interface{}{
+			"error": fmt.Sprint(err),
+		})
+	}
+
+	vsince, vasof, err := parseValidTimeParams(r)
+
+	if err != nil {
+		return c.JSON(StatusUnprocessableEntity, map[string]interface{}{
+			"error": fmt.Sprint(err),
+		})
+	}
+
+	result, err := query.Run(e, q, query.Options{
+		DefaultDomain: r.URL.Query().Get("domain"),
+		Since:         since,
+		Asof:          asof,
+		ValidSince:    vsince,
+		ValidAsof:     vasof,
+	})
+
+	if err != nil {
+		code := http.StatusInternalServerError
+
+		if err == query.ErrNoDomain {
+			code = StatusUnprocessableEntity
+		}
+
+		return c.JSON(code, map[string]interface{}{
+			"error": fmt.Sprint(err),
+		})
+	}
+
+	if detectFormat(w, r) == "csv" {
+		return result.WriteCSV(w)
+	}
+
+	return c.JSON(http.StatusOK, result)
 }
 
 func httpDomainEntities(c *echo.Context) error {
@@ -219,3 +493,108 @@ func httpDomainValues(c *echo.Context) error {
 
 	return c.JSON(http.StatusOK, idents)
 }
+
+// requireToken returns a handler that responds with 401 Unauthorized unless
+// the request supplies the token in the Authorization header.
+func requireToken(token string, h func(*echo.Context) error) func(*echo.Context) error {
+	expected := []byte("Bearer " + token)
+
+	return func(c *echo.Context) error {
+		supplied := []byte(c.Request().Header.Get("Authorization"))
+
+		if subtle.ConstantTimeCompare(supplied, expected) != 1 {
+			return c.JSON(http.StatusUnauthorized, map[string]interface{}{
+				"error": "invalid or missing token",
+			})
+		}
+
+		return h(c)
+	}
+}
+
+// httpTransact transacts the CSV-formatted facts in the request body. The
+// domain query parameter sets the default domain of the facts. Metadata about
+// the transaction is supplied as key=value pairs in the X-Origins-Meta header
+// which may be repeated. Retried requests should supply the same key in the
+// Idempotency-Key header so the facts are only committed once. If the preview
+// query parameter is true, the transaction is aborted and the facts and events
+// it would cause are returned.
+func httpTransact(c *echo.Context) error {
+	r := c.Request()
+	w := c.Response()
+	e := c.Get("engine").(storage.Engine)
+
+	preview, _ := strconv.ParseBool(r.URL.Query().Get("preview"))
+
+	meta, err := transactor.ParseMeta(r.Header[metaHeader])
+
+	if err != nil {
+		return c.JSON(StatusUnprocessableEntity, map[string]interface{}{
+			"error": fmt.Sprint(err),
+		})
+	}
+
+	tx, err := transactor.New(e, transactor.Options{
+		DefaultDomain:  r.URL.Query().Get("domain"),
+		Meta:           meta,
+		Preview:        preview,
+		IdempotencyKey: r.Header.Get(idempotencyHeader),
+	})
+
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]interface{}{
+			"error": fmt.Sprint(err),
+		})
+	}
+
+	iter := origins.NewCSVReader(origins.NewUniversalReader(r.Body))
+
+	if _, err = origins.Copy(iter, tx); err == nil {
+		err = iter.Err()
+	}
+
+	if err != nil {
+		tx.Cancel()
+
+		return c.JSON(StatusUnprocessableEntity, map[string]interface{}{
+			"error": fmt.Sprint(err),
+		})
+	}
+
+	if err = tx.Commit(); err != nil {
+		return c.JSON(StatusUnprocessableEntity, map[string]interface{}{
+			"error": fmt.Sprint(err),
+		})
+	}
+
+	if err = tx.CommitError; err != nil {
+		code := StatusUnprocessableEntity
+
+		if err == transactor.ErrCommitConflict {
+			code = http.StatusConflict
+		}
+
+		return c.JSON(code, map[string]interface{}{
+			"error": fmt.Sprint(err),
+		})
+	}
+
+	if !preview {
+		return c.JSON(http.StatusOK, tx.Info())
+	}
+
+	pv, err := tx.Preview()
+
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]interface{}{
+			"error": fmt.Sprint(err),
+		})
+	}
+
+	switch detectFormat(w, r) {
+	case "csv":
+		return pv.WriteCSV(w)
+	}
+
+	return c.JSON(http.StatusOK, pv)
+}
@@ -0,0 +1,119 @@
+package http
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"strconv"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/chop-dbhi/origins"
+	"github.com/chop-dbhi/origins/transactor"
+	"github.com/labstack/echo"
+	mw "github.com/labstack/echo/middleware"
+)
+
+// ServeTransactor serves the transactor service on the listener. Fact streams
+// submitted to the service are queued and transacted by the queue, which
+// serializes commits to the same domain.
+func ServeTransactor(queue *transactor.Queue, l net.Listener, debug bool) error {
+	e := echo.New()
+
+	e.SetDebug(debug)
+
+	e.Use(mw.Logger())
+	e.Use(mw.Recover())
+
+	// Adds the queue to the context.
+	e.Use(func(c *echo.Context) error {
+		c.Set("queue", queue)
+		return nil
+	})
+
+	e.Get("/", httpQueueStatus)
+	e.Get("/transactions", httpQueueStatus)
+	e.Post("/transactions", httpQueueSubmit)
+	e.Get("/transactions/:id", httpQueueJob)
+
+	logrus.Infof("* Transactor listening on %s...", l.Addr())
+
+	return http.Serve(l, e)
+}
+
+func httpQueueStatus(c *echo.Context) error {
+	q := c.Get("queue").(*transactor.Queue)
+
+	return c.JSON(http.StatusOK, q.Status())
+}
+
+func httpQueueJob(c *echo.Context) error {
+	q := c.Get("queue").(*transactor.Queue)
+
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]interface{}{
+			"error": fmt.Sprint(err),
+		})
+	}
+
+	job := q.Job(id)
+
+	if job == nil {
+		return c.JSON(http.StatusNotFound, map[string]interface{}{
+			"error": "job does not exist",
+		})
+	}
+
+	return c.JSON(http.StatusOK, job)
+}
+
+// httpQueueSubmit queues the CSV-formatted facts in the request body. The
+// domain query parameter and the metadata and idempotency key headers are
+// handled the same as the transact endpoint. By default the response is sent
+// once the job is finished. If the wait query parameter is false, the queued
+// job is returned immediately and its status can be polled.
+func httpQueueSubmit(c *echo.Context) error {
+	r := c.Request()
+	q := c.Get("queue").(*transactor.Queue)
+
+	wait := true
+
+	if v := r.URL.Query().Get("wait"); v != "" {
+		wait, _ = strconv.ParseBool(v)
+	}
+
+	meta, err := transactor.ParseMeta(r.Header[metaHeader])
+
+	if err != nil {
+		return c.JSON(StatusUnprocessableEntity, map[string]interface{}{
+			"error": fmt.Sprint(err),
+		})
+	}
+
+	job, err := q.Submit(origins.NewCSVReader(origins.NewUniversalReader(r.Body)), transactor.Options{
+		DefaultDomain:  r.URL.Query().Get("domain"),
+		Meta:           meta,
+		IdempotencyKey: r.Header.Get(idempotencyHeader),
+	})
+
+	if err != nil {
+		return c.JSON(StatusUnprocessableEntity, map[string]interface{}{
+			"error": fmt.Sprint(err),
+		})
+	}
+
+	if !wait {
+		return c.JSON(http.StatusAccepted, q.Job(job.ID))
+	}
+
+	q.Wait(job)
+
+	job = q.Job(job.ID)
+
+	if job.State == transactor.JobFailed {
+		return c.JSON(StatusUnprocessableEntity, job)
+	}
+
+	return c.JSON(http.StatusOK, job)
+}
@@ -1,6 +1,7 @@
 package http
 
 import (
+	"encoding/json"
 	"mime"
 	"net/http"
 	"strconv"
@@ -11,6 +12,7 @@ import (
 	"github.com/chop-dbhi/origins/chrono"
 	"github.com/chop-dbhi/origins/storage"
 	"github.com/chop-dbhi/origins/view"
+	"github.com/labstack/echo"
 )
 
 const defaultFormat = "json"
@@ -66,11 +68,11 @@ func detectFormat(w http.ResponseWriter, r *http.Request) string {
 func domainIteratorResource(domain string, r *http.Request, e storage.Engine) (origins.Iterator, int, error) {
 	var (
 		err           error
-		since, asof   time.Time
+		options       view.Options
 		offset, limit int
 	)
 
-	if since, asof, err = parseTimeParams(r); err != nil {
+	if options, err = parseViewParams(r); err != nil {
 		return nil, StatusUnprocessableEntity, err
 	}
 
@@ -88,7 +90,7 @@ func domainIteratorResource(domain string, r *http.Request, e storage.Engine) (o
 		return nil, http.StatusInternalServerError, err
 	}
 
-	iter := log.View(since, asof)
+	iter := log.Read(options)
 
 	if offset > 0 || limit > 0 {
 		iter = origins.Slice(iter, offset, limit)
@@ -122,6 +124,77 @@ func parseTimeParams(r *http.Request) (time.Time, time.Time, error) {
 	return since, asof, nil
 }
 
+// Parses the valid_since and valid_asof time values from the request. These
+// bound the valid time of the facts rather than the time they were transacted.
+func parseValidTimeParams(r *http.Request) (time.Time, time.Time, error) {
+	var (
+		err         error
+		since, asof time.Time
+	)
+
+	q := r.URL.Query()
+
+	if q.Get("valid_since") != "" {
+		if since, err = chrono.Parse(q.Get("valid_since")); err != nil {
+			return since, asof, err
+		}
+	}
+
+	if q.Get("valid_asof") != "" {
+		if asof, err = chrono.Parse(q.Get("valid_asof")); err != nil {
+			return since, asof, err
+		}
+	}
+
+	return since, asof, nil
+}
+
+// Parses the since_tx and asof_tx transaction IDs from the request.
+func parseTxParams(r *http.Request) (uint64, uint64, error) {
+	var (
+		err             error
+		sinceTx, asofTx uint64
+	)
+
+	q := r.URL.Query()
+
+	if q.Get("since_tx") != "" {
+		if sinceTx, err = strconv.ParseUint(q.Get("since_tx"), 10, 64); err != nil {
+			return sinceTx, asofTx, err
+		}
+	}
+
+	if q.Get("asof_tx") != "" {
+		if asofTx, err = strconv.ParseUint(q.Get("asof_tx"), 10, 64); err != nil {
+			return sinceTx, asofTx, err
+		}
+	}
+
+	return sinceTx, asofTx, nil
+}
+
+// Parses the time, valid time and transaction bounds of a view from the request.
+func parseViewParams(r *http.Request) (view.Options, error) {
+	var (
+		err error
+		o   view.Options
+	)
+
+	if o.Since, o.Asof, err = parseTimeParams(r); err != nil {
+		return o, err
+	}
+
+	if o.ValidSince, o.ValidAsof, err = parseValidTimeParams(r); err != nil {
+		return o, err
+	}
+
+	if o.SinceTx, o.AsofTx, err = parseTxParams(r); err != nil {
+		return o, err
+	}
+
+	return o, nil
+}
+
 // Parses the offset and limit from the request.
 func parseSliceParams(r *http.Request) (int, int, error) {
 	var (
@@ -145,3 +218,90 @@ func parseSliceParams(r *http.Request) (int, int, error) {
 
 	return offset, limit, nil
 }
+
+// Number of events written to a stream between flushes.
+const flushEvents = 100
+
+// streamEventsJSON writes the events as a JSON array, flushing the response
+// periodically so clients receive events as they are derived.
+func streamEventsJSON(w *echo.Response, iter view.EventIterator) error {
+	var (
+		e *view.Event
+		n int
+	)
+
+	for {
+		if e = iter.Next(); e == nil {
+			break
+		}
+
+		b, err := json.Marshal(e)
+
+		if err != nil {
+			return err
+		}
+
+		if n == 0 {
+			w.WriteHeader(http.StatusOK)
+			b = append([]byte{'['}, b...)
+		} else {
+			b = append([]byte{','}, b...)
+		}
+
+		if _, err = w.Write(b); err != nil {
+			return err
+		}
+
+		if n++; n%flushEvents == 0 {
+			w.Flush()
+		}
+	}
+
+	if err := iter.Err(); err != nil {
+		return err
+	}
+
+	if n == 0 {
+		w.WriteHeader(http.StatusOK)
+		_, err := w.Write([]byte("[]\n"))
+		return err
+	}
+
+	_, err := w.Write([]byte("]\n"))
+
+	return err
+}
+
+// streamEventsCSV writes the events as CSV, flushing the response periodically.
+func streamEventsCSV(w *echo.Response, iter view.EventIterator) error {
+	var (
+		e *view.Event
+		n int
+	)
+
+	cw := view.NewEventCSVWriter(w)
+
+	for {
+		if e = iter.Next(); e == nil {
+			break
+		}
+
+		if err := cw.Write(e); err != nil {
+			return err
+		}
+
+		if n++; n%flushEvents == 0 {
+			if err := cw.Flush(); err != nil {
+				return err
+			}
+
+			w.Flush()
+		}
+	}
+
+	if err := iter.Err(); err != nil {
+		return err
+	}
+
+	return cw.Flush()
+}
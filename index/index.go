@@ -0,0 +1,206 @@
+// The index package maintains sorted covering indexes of the facts in a
+// domain. Each index is stored in its own storage part and is keyed by the
+// entity, attribute, value and transaction of the facts in the order of
+// the index, so range scans over the leading components are efficient.
+package index
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/chop-dbhi/origins"
+	"github.com/chop-dbhi/origins/dal"
+	"github.com/chop-dbhi/origins/storage"
+)
+
+var ErrBadKey = errors.New("index: invalid key")
+
+// Index names the order of the components of an index.
+type Index string
+
+const (
+	EAVT Index = "eavt"
+	AEVT Index = "aevt"
+	AVET Index = "avet"
+	VAET Index = "vaet"
+)
+
+// LogName is the name of the log that points to the segment the indexes of
+// a domain were last updated with.
+const LogName = "index"
+
+// Indexes are the indexes maintained for each domain.
+var Indexes = []Index{EAVT, AEVT, AVET, VAET}
+
+// Separator of the components of a key. This sorts before any character
+// in an identity, so keys sort the same as the comparators of the index.
+const separator = '\x00'
+
+// Part returns the storage part of the index of the domain. Domains cannot
+// contain a slash, so the part does not collide with a domain.
+func Part(domain string, idx Index) string {
+	return fmt.Sprintf("%s/%s", domain, idx)
+}
+
+// order returns the entity, attribute and value in the order of the index.
+func (idx Index) order(e, a, v *origins.Ident) [3]*origins.Ident {
+	switch idx {
+	case AEVT:
+		return [3]*origins.Ident{a, e, v}
+	case AVET:
+		return [3]*origins.Ident{a, v, e}
+	case VAET:
+		return [3]*origins.Ident{v, a, e}
+	}
+
+	return [3]*origins.Ident{e, a, v}
+}
+
+// unorder returns the entity, attribute and value from the components in
+// the order of the index.
+func (idx Index) unorder(c [3]*origins.Ident) (*origins.Ident, *origins.Ident, *origins.Ident) {
+	switch idx {
+	case AEVT:
+		return c[1], c[0], c[2]
+	case AVET:
+		return c[2], c[0], c[1]
+	case VAET:
+		return c[2], c[1], c[0]
+	}
+
+	return c[0], c[1], c[2]
+}
+
+// prefix encodes the identities as the leading components of a key.
+func prefix(idents ...*origins.Ident) string {
+	var b bytes.Buffer
+
+	for _, id := range idents {
+		b.WriteString(id.Domain)
+		b.WriteByte(separator)
+		b.WriteString(id.Name)
+		b.WriteByte(separator)
+	}
+
+	return b.String()
+}
+
+// key encodes the key of the fact in the index. The transaction is encoded
+// big endian so the versions of a fact are ordered by transaction.
+func key(idx Index, f *origins.Fact) string {
+	c := idx.order(f.Entity, f.Attribute, f.Value)
+
+	buf := make([]byte, 8)
+	binary.BigEndian.PutUint64(buf, f.Transaction)
+
+	return prefix(c[0], c[1], c[2]) + string(buf)
+}
+
+// value encodes the operation and time of the fact.
+func value(f *origins.Fact) ([]byte, error) {
+	buf := []byte{byte(f.Operation)}
+
+	if f.Time.IsZero() {
+		return buf, nil
+	}
+
+	t, err := f.Time.MarshalBinary()
+
+	if err != nil {
+		return nil, err
+	}
+
+	return append(buf, t...), nil
+}
+
+// decode decodes the entry of the index into a fact.
+func decode(domain string, idx Index, k string, v []byte) (*origins.Fact, error) {
+	parts := strings.SplitN(k, string(separator), 7)
+
+	if len(parts) != 7 || len(parts[6]) != 8 || len(v) == 0 {
+		return nil, ErrBadKey
+	}
+
+	var c [3]*origins.Ident
+
+	for i := range c {
+		c[i] = &origins.Ident{
+			Domain: parts[i*2],
+			Name:   parts[i*2+1],
+		}
+	}
+
+	f := origins.Fact{
+		Domain:      domain,
+		Operation:   origins.Operation(v[0]),
+		Transaction: binary.BigEndian.Uint64([]byte(parts[6])),
+	}
+
+	f.Entity, f.Attribute, f.Value = idx.unorder(c)
+
+	if len(v) > 1 {
+		var t time.Time
+
+		if err := t.UnmarshalBinary(v[1:]); err != nil {
+			return nil, err
+		}
+
+		f.Time = t
+	}
+
+	return &f, nil
+}
+
+// Write adds the fact to each index of the domain.
+func Write(tx storage.Tx, domain string, f *origins.Fact) error {
+	v, err := value(f)
+
+	if err != nil {
+		return err
+	}
+
+	for _, idx := range Indexes {
+		if err = tx.Set(Part(domain, idx), key(idx, f), v); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Delete removes the fact from each index of the domain.
+func Delete(tx storage.Tx, domain string, f *origins.Fact) error {
+	for _, idx := range Indexes {
+		if err := tx.Delete(Part(domain, idx), key(idx, f)); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Current returns true if the indexes of the domain include every segment
+// of its commit log.
+func Current(engine storage.Engine, domain string) (bool, error) {
+	log, err := dal.GetLog(engine, domain, "commit")
+
+	if err != nil || log == nil {
+		return false, err
+	}
+
+	ilog, err := dal.GetLog(engine, domain, LogName)
+
+	if err != nil || ilog == nil {
+		return false, err
+	}
+
+	if log.Head == nil || ilog.Head == nil {
+		return log.Head == ilog.Head, nil
+	}
+
+	return *log.Head == *ilog.Head, nil
+}
@@ -0,0 +1,191 @@
+package index_test
+
+import (
+	"testing"
+
+	"github.com/chop-dbhi/origins"
+	"github.com/chop-dbhi/origins/dal"
+	"github.com/chop-dbhi/origins/index"
+	"github.com/chop-dbhi/origins/testutil"
+	"github.com/chop-dbhi/origins/testutil/txtest"
+	"github.com/chop-dbhi/origins/transactor"
+	"github.com/chop-dbhi/origins/view"
+)
+
+// names returns the names of the entities of the facts.
+func names(t *testing.T, iter origins.Iterator) []string {
+	facts, err := origins.ReadAll(iter)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	names := make([]string, len(facts))
+
+	for i, f := range facts {
+		names[i] = f.Entity.Name
+	}
+
+	return names
+}
+
+func TestScan(t *testing.T) {
+	engine, _ := origins.Init("memory", nil)
+
+	tx := txtest.TransactCSV(t, engine, "test", `
+entity,attribute,value_domain,value
+bob,city,,Norristown
+bob,employer,companies,chop
+sue,employer,companies,chop
+sue,city,,Bethlehem
+tom,city,,Allentown
+`)
+
+	txtest.TransactCSV(t, engine, "test", `
+operation,entity,attribute,value
+retract,bob,city,Norristown
+assert,bob,city,Bethlehem
+`)
+
+	city := &origins.Ident{Domain: "test", Name: "city"}
+	bethlehem := &origins.Ident{Name: "Bethlehem"}
+	chop := &origins.Ident{Domain: "companies", Name: "chop"}
+
+	// Entities where the attribute has the value.
+	iter := index.Scan(engine, "test", index.AVET, index.Prefix(city, bethlehem))
+	testutil.CheckStrings(t, []string{"bob", "sue"}, names(t, iter))
+
+	// Entities referring to an entity.
+	iter = index.Scan(engine, "test", index.VAET, index.Prefix(chop))
+	testutil.CheckStrings(t, []string{"bob", "sue"}, names(t, iter))
+
+	// As of the first transaction.
+	iter = index.Scan(engine, "test", index.AVET, index.Range{
+		Start: []*origins.Ident{city, bethlehem},
+		End:   []*origins.Ident{city, bethlehem},
+		Asof:  tx.ID,
+	})
+
+	testutil.CheckStrings(t, []string{"sue"}, names(t, iter))
+
+	// Values in a range.
+	iter = index.Scan(engine, "test", index.AVET, index.Range{
+		Start: []*origins.Ident{city, {Name: "B"}},
+		End:   []*origins.Ident{city, {Name: "Norristown"}},
+	})
+
+	testutil.CheckStrings(t, []string{"bob", "sue"}, names(t, iter))
+
+	// The history of a fact in transaction order.
+	iter = index.Scan(engine, "test", index.EAVT, index.Range{
+		Start:   []*origins.Ident{{Domain: "test", Name: "bob"}, city},
+		End:     []*origins.Ident{{Domain: "test", Name: "bob"}, city},
+		History: true,
+	})
+
+	facts, _ := origins.ReadAll(iter)
+
+	if len(facts) != 3 {
+		t.Fatalf("expected 3 facts, got %d", len(facts))
+	}
+
+	if facts[1].Value.Name != "Norristown" || facts[1].Operation != origins.Assertion {
+		t.Errorf("expected assertion of Norristown, got %s", facts[1])
+	}
+
+	if facts[2].Value.Name != "Norristown" || facts[2].Operation != origins.Retraction {
+		t.Errorf("expected retraction of Norristown, got %s", facts[2])
+	}
+}
+
+func TestScanState(t *testing.T) {
+	engine, _ := origins.Init("memory", nil)
+
+	// Enough facts to span several pages.
+	for i := 0; i < 3; i++ {
+		tx, _ := transactor.New(engine, transactor.Options{})
+		origins.Copy(testutil.NewRandGenerator("test", tx.ID, 1500), tx)
+		tx.Commit()
+	}
+
+	log, err := view.OpenLog(engine, "test", "commit")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	state, err := origins.ReadAll(log.State())
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, idx := range index.Indexes {
+		facts, err := origins.ReadAll(index.Scan(engine, "test", idx, index.Range{}))
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if len(facts) != len(state) {
+			t.Errorf("%s: expected %d facts, got %d", idx, len(state), len(facts))
+		}
+	}
+
+	facts, _ := origins.ReadAll(index.Scan(engine, "test", index.EAVT, index.Range{}))
+
+	for i, f := range facts {
+		if !f.Entity.Is(state[i].Entity) || !f.Attribute.Is(state[i].Attribute) || !f.Value.Is(state[i].Value) {
+			t.Fatalf("expected %s, got %s", state[i], f)
+		}
+	}
+}
+
+func TestMaintenance(t *testing.T) {
+	engine, _ := origins.Init("memory", nil)
+
+	// Facts loaded in bulk are indexed at commit.
+	tx, _ := transactor.New(engine, transactor.Options{
+		BulkLoad: true,
+	})
+
+	origins.Copy(testutil.NewRandGenerator("test", tx.ID, 100), tx)
+	tx.Commit()
+
+	facts, _ := origins.ReadAll(index.Scan(engine, "test", index.AEVT, index.Range{History: true}))
+
+	if len(facts) != 100 {
+		t.Fatalf("expected 100 facts, got %d", len(facts))
+	}
+
+	// Excised facts are removed.
+	entity := facts[0].Entity
+
+	n, err := transactor.Excise(engine, transactor.Excision{
+		Domain: "test",
+		Entity: entity,
+	})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	facts, _ = origins.ReadAll(index.Scan(engine, "test", index.EAVT, index.Prefix(entity)))
+
+	if len(facts) != 0 {
+		t.Errorf("expected excised facts to be removed, got %d", len(facts))
+	}
+
+	// Indexes are brought up to date from the start of the log.
+	dal.DeleteLog(engine, "test", "index")
+
+	if err := transactor.Reindex(engine, "test"); err != nil {
+		t.Fatal(err)
+	}
+
+	facts, _ = origins.ReadAll(index.Scan(engine, "test", index.AEVT, index.Range{History: true}))
+
+	if len(facts) != 100-n {
+		t.Errorf("expected %d facts, got %d", 100-n, len(facts))
+	}
+}
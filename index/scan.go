@@ -0,0 +1,193 @@
+package index
+
+import (
+	"github.com/chop-dbhi/origins"
+	"github.com/chop-dbhi/origins/storage"
+)
+
+// Number of entries read from storage at a time by a scan.
+var pageSize = 1000
+
+// Range bounds a scan of an index. The bounds are the leading components
+// of the index in its order, such as the attribute and value for AVET.
+type Range struct {
+	// Entries whose leading components are greater than or equal to Start
+	// and less than or equal to End are scanned. If nil, the range is not
+	// bounded.
+	Start []*origins.Ident
+	End   []*origins.Ident
+
+	// If greater than zero, only facts of transactions up to and including
+	// this one are considered.
+	Asof uint64
+
+	// If true, every fact in the range is returned in index order. Otherwise
+	// only the facts that are asserted as of the last transaction are.
+	History bool
+}
+
+// Prefix returns a range of the entries whose leading components are the
+// identities. For example, the entities referring to an entity are scanned
+// using Prefix(entity) on the VAET index.
+func Prefix(idents ...*origins.Ident) Range {
+	return Range{
+		Start: idents,
+		End:   idents,
+	}
+}
+
+// scanner iterates over the entries of an index in pages.
+type scanner struct {
+	engine storage.Engine
+	domain string
+	index  Index
+	part   string
+	rng    Range
+
+	// Start and end keys of the remaining entries.
+	next string
+	end  string
+
+	page []*origins.Fact
+	keys []string
+	pos  int
+	done bool
+	err  error
+
+	// Most recent fact of the current entity, attribute and value.
+	group  string
+	latest *origins.Fact
+}
+
+// fetch reads the next page of entries.
+func (s *scanner) fetch() error {
+	s.page = s.page[:0]
+	s.keys = s.keys[:0]
+	s.pos = 0
+
+	var derr error
+
+	err := s.engine.Scan(s.part, s.next, s.end, func(k string, v []byte) bool {
+		f, err := decode(s.domain, s.index, k, v)
+
+		if err != nil {
+			derr = err
+			return false
+		}
+
+		s.page = append(s.page, f)
+		s.keys = append(s.keys, k)
+
+		return len(s.page) < pageSize
+	})
+
+	if err != nil {
+		return err
+	}
+
+	if derr != nil {
+		return derr
+	}
+
+	if len(s.page) < pageSize {
+		s.done = true
+	} else {
+		// The smallest key greater than the last one.
+		s.next = s.keys[len(s.keys)-1] + string(separator)
+	}
+
+	return nil
+}
+
+// read returns the next entry and its key without the transaction.
+func (s *scanner) read() (*origins.Fact, string) {
+	if s.pos == len(s.page) {
+		if s.done {
+			return nil, ""
+		}
+
+		if s.err = s.fetch(); s.err != nil {
+			return nil, ""
+		}
+
+		if len(s.page) == 0 {
+			return nil, ""
+		}
+	}
+
+	f := s.page[s.pos]
+	k := s.keys[s.pos]
+
+	s.pos++
+
+	return f, k[:len(k)-8]
+}
+
+func (s *scanner) Next() *origins.Fact {
+	for s.err == nil {
+		f, group := s.read()
+
+		if s.err != nil {
+			return nil
+		}
+
+		if f != nil && s.rng.Asof > 0 && f.Transaction > s.rng.Asof {
+			continue
+		}
+
+		if s.rng.History {
+			return f
+		}
+
+		// The entries of a fact are ordered by transaction, so the last
+		// one of each group determines if the fact is asserted.
+		if f != nil && group == s.group {
+			s.latest = f
+			continue
+		}
+
+		prev := s.latest
+
+		s.group = group
+		s.latest = f
+
+		if prev != nil && prev.Operation == origins.Assertion {
+			return prev
+		}
+
+		if f == nil {
+			return nil
+		}
+	}
+
+	return nil
+}
+
+func (s *scanner) Err() error {
+	return s.err
+}
+
+// Scan returns an iterator of the facts in the index of the domain that are
+// in the range. Facts are returned in the order of the index.
+func Scan(engine storage.Engine, domain string, idx Index, rng Range) origins.Iterator {
+	s := scanner{
+		engine: engine,
+		domain: domain,
+		index:  idx,
+		part:   Part(domain, idx),
+		rng:    rng,
+	}
+
+	if len(rng.Start) > 0 {
+		s.next = prefix(rng.Start...)
+	}
+
+	// Keys with the end prefix are less than the prefix with the last
+	// separator incremented.
+	if len(rng.End) > 0 {
+		end := prefix(rng.End...)
+		s.end = end[:len(end)-1] + string(separator+1)
+	}
+
+	return &s
+}
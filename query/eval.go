@@ -0,0 +1,502 @@
+package query
+
+import (
+	"encoding/csv"
+	"errors"
+	"io"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/chop-dbhi/origins"
+	"github.com/chop-dbhi/origins/index"
+	"github.com/chop-dbhi/origins/storage"
+	"github.com/chop-dbhi/origins/view"
+)
+
+var ErrNoDomain = errors.New("query: clause domain cannot be determined")
+
+// Options alter the evaluation of a query.
+type Options struct {
+	// Domain of clauses whose domain cannot be determined from their terms.
+	// Entities and attributes without a domain default to the clause domain.
+	DefaultDomain string
+
+	// Time bounds of the facts. The facts asserted as of the upper bound
+	// among those transacted after the lower bound are matched.
+	Since time.Time
+	Asof  time.Time
+
+	// Bounds of the valid time of the facts.
+	ValidSince time.Time
+	ValidAsof  time.Time
+}
+
+// Result holds the distinct tuples of values bound to the find variables.
+type Result struct {
+	Vars   []string
+	Tuples [][]*origins.Ident
+}
+
+// WriteCSV writes the result with a header of the variable names.
+func (r *Result) WriteCSV(w io.Writer) error {
+	cw := csv.NewWriter(w)
+
+	if err := cw.Write(r.Vars); err != nil {
+		return err
+	}
+
+	row := make([]string, len(r.Vars))
+
+	for _, t := range r.Tuples {
+		for i, v := range t {
+			row[i] = v.String()
+		}
+
+		if err := cw.Write(row); err != nil {
+			return err
+		}
+	}
+
+	cw.Flush()
+
+	return cw.Error()
+}
+
+// binding maps variable names to values.
+type binding map[string]*origins.Ident
+
+// plan is a clause whose domain and constants are resolved.
+type plan struct {
+	domain string
+	terms  [3]*Term
+}
+
+// components returns the entity, attribute and value of the fact.
+func components(f *origins.Fact) [3]*origins.Ident {
+	return [3]*origins.Ident{f.Entity, f.Attribute, f.Value}
+}
+
+// resolve determines the domain of the clause and qualifies the entity
+// and attribute constants.
+func resolve(c *Clause, options Options) (*plan, error) {
+	p := plan{
+		domain: c.Domain,
+		terms:  c.terms(),
+	}
+
+	if p.domain == "" && p.terms[1].Ident != nil && p.terms[1].Ident.Domain != "" {
+		p.domain = p.terms[1].Ident.Domain
+	}
+
+	if p.domain == "" && p.terms[0].Ident != nil && p.terms[0].Ident.Domain != "" {
+		p.domain = p.terms[0].Ident.Domain
+	}
+
+	if p.domain == "" {
+		p.domain = options.DefaultDomain
+	}
+
+	if p.domain == "" {
+		return nil, ErrNoDomain
+	}
+
+	for i := 0; i < 2; i++ {
+		if id := p.terms[i].Ident; id != nil && id.Domain == "" {
+			p.terms[i] = &Term{
+				Ident: &origins.Ident{
+					Domain: p.domain,
+					Name:   id.Name,
+				},
+			}
+		}
+	}
+
+	return &p, nil
+}
+
+// unify extends the binding with the values of the fact if it matches the
+// terms. Nil is returned if it does not match.
+func unify(b binding, terms [3]*Term, f *origins.Fact) binding {
+	var ext binding
+
+	for i, v := range components(f) {
+		t := terms[i]
+
+		switch {
+		case t.Wildcard:
+			continue
+
+		case t.Ident != nil:
+			if !t.Ident.Is(v) {
+				return nil
+			}
+
+		default:
+			if bv, ok := b[t.Var]; ok {
+				if !bv.Is(v) {
+					return nil
+				}
+
+				continue
+			}
+
+			if bv, ok := ext[t.Var]; ok {
+				if !bv.Is(v) {
+					return nil
+				}
+
+				continue
+			}
+
+			if ext == nil {
+				ext = make(binding, len(b)+3)
+
+				for k, v := range b {
+					ext[k] = v
+				}
+			}
+
+			ext[t.Var] = v
+		}
+	}
+
+	if ext == nil {
+		return b
+	}
+
+	return ext
+}
+
+// evaluator evaluates queries against the logs of domains.
+type evaluator struct {
+	engine  storage.Engine
+	options Options
+
+	// Facts in the state of each domain.
+	states map[string]origins.Facts
+
+	// Domains whose indexes are current.
+	indexed map[string]bool
+}
+
+// state returns the facts in the state of the domain within the bounds.
+func (e *evaluator) state(domain string) (origins.Facts, error) {
+	if facts, ok := e.states[domain]; ok {
+		return facts, nil
+	}
+
+	log, err := view.OpenLog(e.engine, domain, "commit")
+
+	if err == view.ErrDoesNotExist {
+		e.states[domain] = nil
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	o := e.options
+
+	facts, err := origins.ReadAll(view.State(log.Bitemporal(o.Since.UTC(), o.Asof.UTC(), o.ValidSince.UTC(), o.ValidAsof.UTC())))
+
+	if err != nil {
+		return nil, err
+	}
+
+	e.states[domain] = facts
+
+	return facts, nil
+}
+
+// useIndex returns true if the indexes of the domain can be scanned. Indexes
+// are not bounded by time, so they are only used for the current state.
+func (e *evaluator) useIndex(domain string) (bool, error) {
+	o := e.options
+
+	if !o.Since.IsZero() || !o.Asof.IsZero() || !o.ValidSince.IsZero() || !o.ValidAsof.IsZero() {
+		return false, nil
+	}
+
+	if ok, seen := e.indexed[domain]; seen {
+		return ok, nil
+	}
+
+	ok, err := index.Current(e.engine, domain)
+
+	if err != nil {
+		return false, err
+	}
+
+	e.indexed[domain] = ok
+
+	return ok, nil
+}
+
+// scan returns the facts in the domain matching the constants using the
+// index whose leading components are constant.
+func (e *evaluator) scan(domain string, c [3]*origins.Ident) (origins.Facts, error) {
+	var (
+		idx    index.Index
+		prefix []*origins.Ident
+	)
+
+	switch {
+	case c[0] != nil:
+		idx = index.EAVT
+		prefix = []*origins.Ident{c[0]}
+
+		if c[1] != nil {
+			prefix = append(prefix, c[1])
+
+			if c[2] != nil {
+				prefix = append(prefix, c[2])
+			}
+		}
+
+	case c[1] != nil && c[2] != nil:
+		idx = index.AVET
+		prefix = []*origins.Ident{c[1], c[2]}
+
+	case c[1] != nil:
+		idx = index.AEVT
+		prefix = []*origins.Ident{c[1]}
+
+	default:
+		idx = index.VAET
+		prefix = []*origins.Ident{c[2]}
+	}
+
+	return origins.ReadAll(index.Scan(e.engine, domain, idx, index.Prefix(prefix...)))
+}
+
+// bound returns the variables of the bindings. Clauses are evaluated in
+// order, so every binding has the same variables.
+func bound(bindings []binding) map[string]struct{} {
+	vars := make(map[string]struct{})
+
+	if len(bindings) > 0 {
+		for k := range bindings[0] {
+			vars[k] = struct{}{}
+		}
+	}
+
+	return vars
+}
+
+// joinKey returns the values of the fact or binding at the positions of the
+// bound variables.
+func joinKey(terms [3]*Term, pos []int, value func(i int, t *Term) *origins.Ident) string {
+	parts := make([]string, len(pos))
+
+	for j, i := range pos {
+		parts[j] = value(i, terms[i]).String()
+	}
+
+	return strings.Join(parts, "\x00")
+}
+
+// join extends the bindings with the facts matching the clause.
+func (e *evaluator) join(bindings []binding, p *plan) ([]binding, error) {
+	vars := bound(bindings)
+
+	// Positions whose value is known before the facts are read.
+	var (
+		pos   []int
+		known bool
+	)
+
+	for i, t := range p.terms {
+		if t.Ident != nil {
+			known = true
+		} else if _, ok := vars[t.Var]; ok && t.Var != "" {
+			pos = append(pos, i)
+			known = true
+		}
+	}
+
+	useIndex, err := e.useIndex(p.domain)
+
+	if err != nil {
+		return nil, err
+	}
+
+	var out []binding
+
+	// Look up the facts for each binding in the index.
+	if useIndex && known {
+		for _, b := range bindings {
+			var c [3]*origins.Ident
+
+			for i, t := range p.terms {
+				if t.Ident != nil {
+					c[i] = t.Ident
+				} else if v, ok := b[t.Var]; ok {
+					c[i] = v
+				}
+			}
+
+			facts, err := e.scan(p.domain, c)
+
+			if err != nil {
+				return nil, err
+			}
+
+			for _, f := range facts {
+				if nb := unify(b, p.terms, f); nb != nil {
+					out = append(out, nb)
+				}
+			}
+		}
+
+		return out, nil
+	}
+
+	facts, err := e.state(p.domain)
+
+	if err != nil {
+		return nil, err
+	}
+
+	// Hash the matching facts by the values of the bound variables.
+	table := make(map[string][]*origins.Fact)
+
+	for _, f := range facts {
+		if unify(binding{}, constants(p.terms), f) == nil {
+			continue
+		}
+
+		c := components(f)
+
+		k := joinKey(p.terms, pos, func(i int, t *Term) *origins.Ident {
+			return c[i]
+		})
+
+		table[k] = append(table[k], f)
+	}
+
+	for _, b := range bindings {
+		k := joinKey(p.terms, pos, func(i int, t *Term) *origins.Ident {
+			return b[t.Var]
+		})
+
+		for _, f := range table[k] {
+			if nb := unify(b, p.terms, f); nb != nil {
+				out = append(out, nb)
+			}
+		}
+	}
+
+	return out, nil
+}
+
+// constants returns the terms with variables replaced by wildcards.
+func constants(terms [3]*Term) [3]*Term {
+	var c [3]*Term
+
+	for i, t := range terms {
+		if t.Ident != nil {
+			c[i] = t
+		} else {
+			c[i] = &Term{Wildcard: true}
+		}
+	}
+
+	return c
+}
+
+// tuples returns the distinct values of the find variables in order.
+func tuples(bindings []binding, vars []string) [][]*origins.Ident {
+	var (
+		out  [][]*origins.Ident
+		keys []string
+		seen = make(map[string]int)
+	)
+
+	for _, b := range bindings {
+		t := make([]*origins.Ident, len(vars))
+		parts := make([]string, len(vars))
+
+		for i, v := range vars {
+			t[i] = b[v]
+			parts[i] = t[i].String()
+		}
+
+		k := strings.Join(parts, "\x00")
+
+		if _, ok := seen[k]; ok {
+			continue
+		}
+
+		seen[k] = len(out)
+		out = append(out, t)
+		keys = append(keys, k)
+	}
+
+	sort.Sort(&byKey{tuples: out, keys: keys})
+
+	return out
+}
+
+// byKey sorts tuples by their keys.
+type byKey struct {
+	tuples [][]*origins.Ident
+	keys   []string
+}
+
+func (s *byKey) Len() int {
+	return len(s.tuples)
+}
+
+func (s *byKey) Swap(i, j int) {
+	s.tuples[i], s.tuples[j] = s.tuples[j], s.tuples[i]
+	s.keys[i], s.keys[j] = s.keys[j], s.keys[i]
+}
+
+func (s *byKey) Less(i, j int) bool {
+	return s.keys[i] < s.keys[j]
+}
+
+// Run evaluates the query against the storage engine. The clauses are joined
+// in order, so clauses that bind the fewest facts should come first.
+func Run(engine storage.Engine, q *Query, options Options) (*Result, error) {
+	e := evaluator{
+		engine:  engine,
+		options: options,
+		states:  make(map[string]origins.Facts),
+		indexed: make(map[string]bool),
+	}
+
+	bindings := []binding{{}}
+
+	for _, c := range q.Clauses {
+		p, err := resolve(c, options)
+
+		if err != nil {
+			return nil, err
+		}
+
+		if bindings, err = e.join(bindings, p); err != nil {
+			return nil, err
+		}
+
+		if len(bindings) == 0 {
+			break
+		}
+	}
+
+	return &Result{
+		Vars:   q.Find,
+		Tuples: tuples(bindings, q.Find),
+	}, nil
+}
+
+// Eval parses and runs the query.
+func Eval(engine storage.Engine, s string, options Options) (*Result, error) {
+	q, err := Parse(s)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return Run(engine, q, options)
+}
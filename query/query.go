@@ -0,0 +1,303 @@
+// The query package evaluates Datalog-style queries over the facts of one or
+// more domains. A query is a list of clauses that each match facts by their
+// entity, attribute and value. Variables shared between clauses join them:
+//
+//	find ?p ?x where [?p person/likes ?s] [?s sports/is ?x]
+//
+// The find part is optional; if omitted, every variable is returned in the
+// order it first appears. Terms of a clause are variables prefixed with a
+// question mark, the wildcard _, identities such as sports/soccer or literal
+// values. Quoted terms are always literal values. A fourth term may name the
+// domain of the facts, otherwise the domain of the attribute or entity is used.
+// Values only join with entities if they are qualified with the entity domain.
+package query
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/chop-dbhi/origins"
+)
+
+var (
+	ErrNoClauses     = errors.New("query: no clauses")
+	ErrUnterminated  = errors.New("query: unterminated clause or string")
+	ErrUnknownFind   = errors.New("query: find variable does not appear in a clause")
+	ErrInvalidClause = errors.New("query: clause must have three terms and an optional domain")
+)
+
+// Term is a component of a clause.
+type Term struct {
+	// Name of the variable without the question mark.
+	Var string
+
+	// Constant the component must be equal to.
+	Ident *origins.Ident
+
+	// True if the term matches anything.
+	Wildcard bool
+}
+
+func (t *Term) String() string {
+	switch {
+	case t.Wildcard:
+		return "_"
+	case t.Var != "":
+		return "?" + t.Var
+	}
+
+	return t.Ident.String()
+}
+
+// Clause matches facts in a domain.
+type Clause struct {
+	Entity    *Term
+	Attribute *Term
+	Value     *Term
+
+	// Explicit domain of the facts.
+	Domain string
+}
+
+func (c *Clause) String() string {
+	s := fmt.Sprintf("[%s %s %s", c.Entity, c.Attribute, c.Value)
+
+	if c.Domain != "" {
+		s += " " + c.Domain
+	}
+
+	return s + "]"
+}
+
+// terms returns the entity, attribute and value terms.
+func (c *Clause) terms() [3]*Term {
+	return [3]*Term{c.Entity, c.Attribute, c.Value}
+}
+
+// Query is a parsed query.
+type Query struct {
+	Find    []string
+	Clauses []*Clause
+}
+
+func (q *Query) String() string {
+	toks := []string{"find"}
+
+	for _, v := range q.Find {
+		toks = append(toks, "?"+v)
+	}
+
+	toks = append(toks, "where")
+
+	for _, c := range q.Clauses {
+		toks = append(toks, c.String())
+	}
+
+	return strings.Join(toks, " ")
+}
+
+// vars returns the variables of the clauses in the order they first appear.
+func (q *Query) vars() []string {
+	var (
+		vars []string
+		seen = make(map[string]struct{})
+	)
+
+	for _, c := range q.Clauses {
+		for _, t := range c.terms() {
+			if t.Var == "" {
+				continue
+			}
+
+			if _, ok := seen[t.Var]; !ok {
+				seen[t.Var] = struct{}{}
+				vars = append(vars, t.Var)
+			}
+		}
+	}
+
+	return vars
+}
+
+// token is a lexical token of a query.
+type token struct {
+	text   string
+	quoted bool
+}
+
+// tokenize splits the query into brackets, words and quoted strings.
+func tokenize(s string) ([]token, error) {
+	var toks []token
+
+	for i := 0; i < len(s); {
+		switch c := s[i]; {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r' || c == ',':
+			i++
+
+		case c == '[' || c == ']':
+			toks = append(toks, token{text: string(c)})
+			i++
+
+		case c == '"':
+			var b []byte
+
+			i++
+
+			for ; i < len(s) && s[i] != '"'; i++ {
+				if s[i] == '\\' && i+1 < len(s) {
+					i++
+				}
+
+				b = append(b, s[i])
+			}
+
+			if i == len(s) {
+				return nil, ErrUnterminated
+			}
+
+			toks = append(toks, token{text: string(b), quoted: true})
+			i++
+
+		default:
+			j := i
+
+			for j < len(s) && !strings.ContainsRune(" \t\n\r,[]\"", rune(s[j])) {
+				j++
+			}
+
+			toks = append(toks, token{text: s[i:j]})
+			i = j
+		}
+	}
+
+	return toks, nil
+}
+
+// parseTerm parses a term of a clause.
+func parseTerm(t token) (*Term, error) {
+	if t.quoted {
+		return &Term{Ident: &origins.Ident{Name: t.text}}, nil
+	}
+
+	if t.text == "_" {
+		return &Term{Wildcard: true}, nil
+	}
+
+	if strings.HasPrefix(t.text, "?") {
+		if len(t.text) == 1 {
+			return nil, fmt.Errorf("query: variable without a name")
+		}
+
+		return &Term{Var: t.text[1:]}, nil
+	}
+
+	id, err := origins.ParseIdent(t.text)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &Term{Ident: id}, nil
+}
+
+// keyword returns the keyword of the token, ignoring a leading colon.
+func keyword(t token) string {
+	if t.quoted {
+		return ""
+	}
+
+	return strings.ToLower(strings.TrimPrefix(t.text, ":"))
+}
+
+// Parse parses a query.
+func Parse(s string) (*Query, error) {
+	toks, err := tokenize(s)
+
+	if err != nil {
+		return nil, err
+	}
+
+	var (
+		q Query
+		i int
+	)
+
+	if i < len(toks) && keyword(toks[i]) == "find" {
+		for i++; i < len(toks) && keyword(toks[i]) != "where" && toks[i].text != "["; i++ {
+			if !strings.HasPrefix(toks[i].text, "?") || toks[i].quoted {
+				return nil, fmt.Errorf("query: expected find variable, got %s", toks[i].text)
+			}
+
+			q.Find = append(q.Find, toks[i].text[1:])
+		}
+	}
+
+	if i < len(toks) && keyword(toks[i]) == "where" {
+		i++
+	}
+
+	for i < len(toks) {
+		if toks[i].text != "[" || toks[i].quoted {
+			return nil, fmt.Errorf("query: expected clause, got %s", toks[i].text)
+		}
+
+		var terms []token
+
+		for i++; i < len(toks) && (toks[i].text != "]" || toks[i].quoted); i++ {
+			terms = append(terms, toks[i])
+		}
+
+		if i == len(toks) {
+			return nil, ErrUnterminated
+		}
+
+		i++
+
+		if len(terms) != 3 && len(terms) != 4 {
+			return nil, ErrInvalidClause
+		}
+
+		var c Clause
+
+		if c.Entity, err = parseTerm(terms[0]); err != nil {
+			return nil, err
+		}
+
+		if c.Attribute, err = parseTerm(terms[1]); err != nil {
+			return nil, err
+		}
+
+		if c.Value, err = parseTerm(terms[2]); err != nil {
+			return nil, err
+		}
+
+		if len(terms) == 4 {
+			c.Domain = terms[3].text
+		}
+
+		q.Clauses = append(q.Clauses, &c)
+	}
+
+	if len(q.Clauses) == 0 {
+		return nil, ErrNoClauses
+	}
+
+	vars := make(map[string]struct{})
+
+	for _, v := range q.vars() {
+		vars[v] = struct{}{}
+	}
+
+	for _, v := range q.Find {
+		if _, ok := vars[v]; !ok {
+			return nil, ErrUnknownFind
+		}
+	}
+
+	if len(q.Find) == 0 {
+		q.Find = q.vars()
+	}
+
+	return &q, nil
+}
@@ -0,0 +1,172 @@
+package query_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/chop-dbhi/origins"
+	"github.com/chop-dbhi/origins/dal"
+	"github.com/chop-dbhi/origins/query"
+	"github.com/chop-dbhi/origins/testutil"
+	"github.com/chop-dbhi/origins/testutil/txtest"
+)
+
+// rows returns the tuples of the result as comma-separated strings.
+func rows(r *query.Result) []string {
+	rows := make([]string, len(r.Tuples))
+
+	for i, t := range r.Tuples {
+		vals := make([]string, len(t))
+
+		for j, v := range t {
+			vals[j] = v.String()
+		}
+
+		rows[i] = strings.Join(vals, ",")
+	}
+
+	return rows
+}
+
+func TestParse(t *testing.T) {
+	q, err := query.Parse(`find ?p ?x where [?p person/likes ?s] [?s sports/is ?x] [_ name "Bill Smith" people]`)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(q.Find) != 2 || q.Find[0] != "p" || q.Find[1] != "x" {
+		t.Errorf("expected find ?p ?x, got %v", q.Find)
+	}
+
+	if len(q.Clauses) != 3 {
+		t.Fatalf("expected 3 clauses, got %d", len(q.Clauses))
+	}
+
+	c := q.Clauses[0]
+
+	if c.Entity.Var != "p" || c.Attribute.Ident.Domain != "person" || c.Attribute.Ident.Name != "likes" || c.Value.Var != "s" {
+		t.Errorf("unexpected clause %s", c)
+	}
+
+	c = q.Clauses[2]
+
+	if !c.Entity.Wildcard || c.Attribute.Ident.Domain != "" || c.Value.Ident.Name != "Bill Smith" || c.Domain != "people" {
+		t.Errorf("unexpected clause %s", c)
+	}
+
+	// Find defaults to the variables in order.
+	if q, err = query.Parse(`[?s sports/is ?x] [?p person/likes ?s]`); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(q.Find) != 3 || q.Find[0] != "s" || q.Find[1] != "x" || q.Find[2] != "p" {
+		t.Errorf("expected find ?s ?x ?p, got %v", q.Find)
+	}
+
+	errors := map[string]error{
+		``:                          query.ErrNoClauses,
+		`find ?x where`:             query.ErrNoClauses,
+		`[?x name`:                  query.ErrUnterminated,
+		`[?x name "Bill]`:           query.ErrUnterminated,
+		`[?x name]`:                 query.ErrInvalidClause,
+		`find ?y where [?x name _]`: query.ErrUnknownFind,
+	}
+
+	for s, expected := range errors {
+		if _, err := query.Parse(s); err != expected {
+			t.Errorf("%q: expected %v, got %v", s, expected, err)
+		}
+	}
+}
+
+func TestRun(t *testing.T) {
+	engine, _ := origins.Init("memory", nil)
+
+	tx := txtest.TransactCSV(t, engine, "people", `domain,entity,attribute,value,value_domain
+people,bill,likes,soccer,sports
+people,bill,likes,tennis,sports
+people,jane,likes,soccer,sports
+people,jane,name,Jane Doe,
+people,joe,likes,golf,sports
+sports,soccer,kind,team,
+sports,tennis,kind,individual,
+`)
+
+	q := `find ?p ?k where [?p people/likes ?s] [?s sports/kind ?k]`
+
+	r, err := query.Eval(engine, q, query.Options{})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	testutil.CheckStrings(t, []string{
+		"people/bill,individual",
+		"people/bill,team",
+		"people/jane,team",
+	}, rows(r))
+
+	// Constants and the default domain.
+	r, err = query.Eval(engine, `find ?p where [?p name "Jane Doe"] [?p likes sports/soccer]`, query.Options{
+		DefaultDomain: "people",
+	})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	testutil.CheckStrings(t, []string{"people/jane"}, rows(r))
+
+	if _, err = query.Eval(engine, `[?p name _]`, query.Options{}); err != query.ErrNoDomain {
+		t.Errorf("expected %v, got %v", query.ErrNoDomain, err)
+	}
+
+	// Missing domains match nothing.
+	if r, err = query.Eval(engine, `[?p likes ?s other]`, query.Options{}); err != nil {
+		t.Fatal(err)
+	}
+
+	testutil.CheckStrings(t, nil, rows(r))
+
+	txtest.TransactCSV(t, engine, "people", `domain,entity,attribute,value,value_domain,operation
+people,bill,likes,soccer,sports,retract
+sports,golf,kind,individual,,
+`)
+
+	checkQuery := func(q string, options query.Options, expected []string) {
+		r, err := query.Eval(engine, q, options)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		testutil.CheckStrings(t, expected, rows(r))
+	}
+
+	current := []string{
+		"people/bill,individual",
+		"people/jane,team",
+		"people/joe,individual",
+	}
+
+	// Evaluated against the indexes and the logs.
+	checkQuery(q, query.Options{}, current)
+
+	if err = dal.DeleteLog(engine, "people", "index"); err != nil {
+		t.Fatal(err)
+	}
+
+	checkQuery(q, query.Options{}, current)
+
+	// Bounded by the first transaction.
+	checkQuery(q, query.Options{Asof: tx.EndTime}, []string{
+		"people/bill,individual",
+		"people/bill,team",
+		"people/jane,team",
+	})
+
+	checkQuery(`[?s sports/kind ?k]`, query.Options{Since: tx.EndTime}, []string{
+		"sports/golf,individual",
+	})
+}
@@ -282,7 +282,7 @@ func Load(engine storage.Engine, domain string) (*Schema, error) {
 		return nil, err
 	}
 
-	iter := log.Now()
+	iter := log.State()
 
 	return Init(domain, iter), nil
 }
@@ -1,10 +1,11 @@
-package schema
+package schema_test
 
 import (
 	"bytes"
 	"testing"
 
 	"github.com/chop-dbhi/origins"
+	"github.com/chop-dbhi/origins/schema"
 	"github.com/chop-dbhi/origins/storage"
 	"github.com/chop-dbhi/origins/testutil"
 	"github.com/chop-dbhi/origins/transactor"
@@ -18,7 +19,10 @@ func setup() storage.Engine {
 
 	iter := origins.NewCSVReader(bytes.NewBuffer(data))
 
-	tx, _ := transactor.New(engine, transactor.Options{})
+	// The schema is written to the reserved attrs domain.
+	tx, _ := transactor.New(engine, transactor.Options{
+		Privileged: true,
+	})
 
 	// Write the facts.
 	if _, err := origins.Copy(iter, tx); err != nil {
@@ -35,9 +39,9 @@ func TestInitSchema(t *testing.T) {
 
 	iter := origins.NewCSVReader(bytes.NewBuffer(data))
 
-	schema := Init("origins.attrs", iter)
+	s := schema.Init("origins.attrs", iter)
 
-	attrs := schema.Attrs()
+	attrs := s.Attrs()
 
 	assert.Equal(t, 18, len(attrs))
 }
@@ -45,13 +49,13 @@ func TestInitSchema(t *testing.T) {
 func TestLoadSchema(t *testing.T) {
 	engine := setup()
 
-	schema, err := Load(engine, "origins.attrs")
+	s, err := schema.Load(engine, "origins.attrs")
 
 	if err != nil {
 		t.Fatal(err)
 	}
 
-	attrs := schema.Attrs()
+	attrs := s.Attrs()
 
 	assert.Equal(t, 6, len(attrs))
 }
@@ -83,6 +83,35 @@ func (t *Tx) Incr(p, k string) (uint64, error) {
 	return id, err
 }
 
+func (t *Tx) Scan(p, start, end string, fn func(string, []byte) bool) error {
+	b := t.tx.Bucket([]byte(p))
+
+	// No bucket.
+	if b == nil {
+		return nil
+	}
+
+	c := b.Cursor()
+
+	for k, v := c.Seek([]byte(start)); k != nil; k, v = c.Next() {
+		key := string(k)
+
+		if end != "" && key >= end {
+			break
+		}
+
+		// Copy bytes.
+		value := make([]byte, len(v))
+		copy(value, v)
+
+		if !fn(key, value) {
+			break
+		}
+	}
+
+	return nil
+}
+
 type Engine struct {
 	Path string
 }
@@ -171,6 +200,22 @@ func (e *Engine) Incr(p, k string) (uint64, error) {
 	return id, nil
 }
 
+func (e *Engine) Scan(p, start, end string, fn func(string, []byte) bool) error {
+	db, err := bolt.Open(e.Path, 0600, nil)
+
+	if err != nil {
+		return err
+	}
+
+	defer db.Close()
+
+	return db.View(func(tx *bolt.Tx) error {
+		t := &Tx{tx}
+
+		return t.Scan(p, start, end, fn)
+	})
+}
+
 func (e *Engine) Multi(f func(tx storage.Tx) error) error {
 	db, err := bolt.Open(e.Path, 0600, nil)
 
@@ -49,6 +49,26 @@ func TestTx(t *testing.T) {
 	test.TestTx(t, "boltdb", e)
 }
 
+func TestScan(t *testing.T) {
+	f, _ := ioutil.TempFile("", "")
+
+	defer func() {
+		os.Remove(f.Name())
+	}()
+
+	e, err := Init(storage.Options{
+		"path": f.Name(),
+	})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	f.Close()
+
+	test.TestScan(t, "boltdb", e)
+}
+
 func BenchmarkEngineGet(b *testing.B) {
 	f, _ := ioutil.TempFile("", "")
 
@@ -16,6 +16,11 @@ type Tx interface {
 
 	// Incr increments an integer or sets it to one for new entries.
 	Incr(part, key string) (uint64, error)
+
+	// Scan calls the function with each key and value in the part whose key
+	// is in the range [start, end) in key order. An empty end does not bound
+	// the range. The scan stops when the function returns false.
+	Scan(part, start, end string, fn func(key string, value []byte) bool) error
 }
 
 // Engine is an interface for defining storage engines.
@@ -32,6 +37,11 @@ type Engine interface {
 	// Incr increments an integer or sets it to one for new entries.
 	Incr(part, key string) (uint64, error)
 
+	// Scan calls the function with each key and value in the part whose key
+	// is in the range [start, end) in key order. An empty end does not bound
+	// the range. The scan stops when the function returns false.
+	Scan(part, start, end string, fn func(key string, value []byte) bool) error
+
 	// Multi takes a function that takes a transaction value. For storages
 	// that support batch writes, this should be used.
 	Multi(func(Tx) error) error
@@ -3,6 +3,7 @@
 package memory
 
 import (
+	"sort"
 	"sync"
 
 	"github.com/chop-dbhi/origins/storage"
@@ -31,6 +32,10 @@ func (t *Tx) Set(p, k string, v []byte) error {
 		t.e.parts[p] = b
 	}
 
+	if _, ok = b[k]; !ok {
+		delete(t.e.keys, p)
+	}
+
 	b[k] = v
 
 	return nil
@@ -38,7 +43,10 @@ func (t *Tx) Set(p, k string, v []byte) error {
 
 func (t *Tx) Delete(p, k string) error {
 	if m, ok := t.e.parts[p]; ok {
-		delete(m, k)
+		if _, ok = m[k]; ok {
+			delete(m, k)
+			delete(t.e.keys, p)
+		}
 	}
 
 	return nil
@@ -59,6 +67,8 @@ func (t *Tx) Incr(p, k string) (uint64, error) {
 
 	if v, ok = b[k]; ok {
 		id = storage.DecodeCounter(v)
+	} else {
+		delete(t.e.keys, p)
 	}
 
 	id++
@@ -68,10 +78,52 @@ func (t *Tx) Incr(p, k string) (uint64, error) {
 	return id, nil
 }
 
+// Scan calls the function with the entries of the part in key order.
+func (t *Tx) Scan(p, start, end string, fn func(string, []byte) bool) error {
+	b, ok := t.e.parts[p]
+
+	if !ok {
+		return nil
+	}
+
+	keys, ok := t.e.keys[p]
+
+	// The keys are sorted once for successive scans of the part.
+	if !ok {
+		keys = make([]string, 0, len(b))
+
+		for k := range b {
+			keys = append(keys, k)
+		}
+
+		sort.Strings(keys)
+
+		t.e.keys[p] = keys
+	}
+
+	for i := sort.SearchStrings(keys, start); i < len(keys); i++ {
+		k := keys[i]
+
+		if end != "" && k >= end {
+			break
+		}
+
+		if !fn(k, b[k]) {
+			break
+		}
+	}
+
+	return nil
+}
+
 // Engine is an in-memory store that keeps data in keyed parts.
 type Engine struct {
 	parts map[string]map[string][]byte
 
+	// Sorted keys of the parts that have been scanned. These are removed
+	// when a key is added to or deleted from the part.
+	keys map[string][]string
+
 	sync.Mutex
 }
 
@@ -111,6 +163,17 @@ func (e *Engine) Incr(p, k string) (uint64, error) {
 	return t.Incr(p, k)
 }
 
+// Scan holds the engine lock while the function is called, so the function
+// must not call the engine.
+func (e *Engine) Scan(p, start, end string, fn func(string, []byte) bool) error {
+	e.Lock()
+	defer e.Unlock()
+
+	t := &Tx{e}
+
+	return t.Scan(p, start, end, fn)
+}
+
 func (e *Engine) Multi(f func(tx storage.Tx) error) error {
 	e.Lock()
 	defer e.Unlock()
@@ -122,6 +185,7 @@ func (e *Engine) Multi(f func(tx storage.Tx) error) error {
 func Init(opts storage.Options) (storage.Engine, error) {
 	e := Engine{
 		parts: make(map[string]map[string][]byte),
+		keys:  make(map[string][]string),
 	}
 
 	return &e, nil
@@ -18,6 +18,12 @@ func TestTx(t *testing.T) {
 	test.TestTx(t, "memory", e)
 }
 
+func TestScan(t *testing.T) {
+	e, _ := Init(nil)
+
+	test.TestScan(t, "memory", e)
+}
+
 func BenchmarkEngineGet(b *testing.B) {
 	e, _ := Init(nil)
 
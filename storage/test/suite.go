@@ -1,6 +1,7 @@
 package test
 
 import (
+	"fmt"
 	"math/rand"
 	"testing"
 
@@ -92,6 +93,72 @@ func TestTx(t *testing.T, n string, e storage.Engine) {
 	}
 }
 
+func TestScan(t *testing.T, n string, e storage.Engine) {
+	p := "scan"
+
+	for _, k := range []string{"b", "a", "c/2", "c/1", "d"} {
+		if err := e.Set(p, k, []byte(k)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	scan := func(start, end string, max int) []string {
+		var keys []string
+
+		err := e.Scan(p, start, end, func(k string, v []byte) bool {
+			if string(v) != k {
+				t.Errorf("%s: expected value %s, got %s", n, k, string(v))
+			}
+
+			keys = append(keys, k)
+
+			return len(keys) < max
+		})
+
+		if err != nil {
+			t.Fatalf("%s: scan error %s", n, err)
+		}
+
+		return keys
+	}
+
+	expected := [][]string{
+		scan("", "", 10),
+		{"a", "b", "c/1", "c/2", "d"},
+
+		scan("c/", "c0", 10),
+		{"c/1", "c/2"},
+
+		scan("b", "", 2),
+		{"b", "c/1"},
+
+		scan("e", "", 10),
+		nil,
+	}
+
+	for i := 0; i < len(expected); i += 2 {
+		if fmt.Sprint(expected[i]) != fmt.Sprint(expected[i+1]) {
+			t.Errorf("%s: expected %v, got %v", n, expected[i+1], expected[i])
+		}
+	}
+
+	// Parts that do not exist are empty.
+	e.Multi(func(tx storage.Tx) error {
+		var count int
+
+		tx.Scan("none", "", "", func(string, []byte) bool {
+			count++
+			return true
+		})
+
+		if count != 0 {
+			t.Errorf("%s: expected no keys, got %d", n, count)
+		}
+
+		return nil
+	})
+}
+
 func BenchmarkEngineGet(b *testing.B, n string, e storage.Engine) {
 	p := "test"
 	k := "data"
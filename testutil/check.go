@@ -0,0 +1,19 @@
+package testutil
+
+import "testing"
+
+// CheckStrings fails the test if the actual strings do not equal the
+// expected ones in order.
+func CheckStrings(t *testing.T, expected, actual []string) {
+	if len(expected) != len(actual) {
+		t.Errorf("expected %v, got %v", expected, actual)
+		return
+	}
+
+	for i := range expected {
+		if expected[i] != actual[i] {
+			t.Errorf("expected %v, got %v", expected, actual)
+			return
+		}
+	}
+}
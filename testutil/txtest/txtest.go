@@ -0,0 +1,34 @@
+// The txtest package provides fixtures for tests that transact facts. It is
+// separate from testutil since the transactor tests import testutil.
+package txtest
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/chop-dbhi/origins"
+	"github.com/chop-dbhi/origins/storage"
+	"github.com/chop-dbhi/origins/transactor"
+)
+
+// TransactCSV commits the facts in the CSV data to the engine with the
+// default domain. The test fails if the transaction cannot be committed.
+func TransactCSV(t *testing.T, engine storage.Engine, domain string, data string) *transactor.Transaction {
+	tx, err := transactor.New(engine, transactor.Options{
+		DefaultDomain: domain,
+	})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err = origins.Copy(origins.NewCSVReader(bytes.NewBufferString(data)), tx); err != nil {
+		t.Fatal(err)
+	}
+
+	if err = tx.Commit(); err != nil {
+		t.Fatal(err)
+	}
+
+	return tx
+}
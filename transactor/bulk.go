@@ -0,0 +1,295 @@
+package transactor
+
+import (
+	"runtime"
+	"sync"
+	"sync/atomic"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/chop-dbhi/origins"
+	"github.com/chop-dbhi/origins/dal"
+	"github.com/chop-dbhi/origins/index"
+	"github.com/chop-dbhi/origins/storage"
+)
+
+// Default number of blocks written per storage transaction in bulk mode.
+var bulkBatchSize = 10
+
+// encodedBlock is a block encoded by a bulk worker.
+type encodedBlock struct {
+	bytes []byte
+	count int
+}
+
+// bulkWriter writes the facts of a segment in bulk. Facts are partitioned
+// across encoder goroutines and the encoded blocks are written to storage in
+// batches by a single writer goroutine, which is the only one that updates
+// the segment.
+type bulkWriter struct {
+	segment *Segment
+	engine  storage.Engine
+	batch   int
+
+	// Function called when an error occurs so the transaction stops
+	// receiving facts.
+	fail func(error)
+
+	// Bytes written by the transaction, the maximum allowed and the
+	// blocks written by the pipeline.
+	written  *int64
+	maxBytes int
+	nblocks  *int64
+
+	// If defined, called after each batch is flushed.
+	progress func()
+
+	workers []chan *origins.Fact
+	next    int
+	blocks  chan *encodedBlock
+
+	wwg sync.WaitGroup
+	bwg sync.WaitGroup
+
+	mu  sync.Mutex
+	err error
+}
+
+// setErr records the first error and signals the transaction.
+func (b *bulkWriter) setErr(err error) {
+	b.mu.Lock()
+	first := b.err == nil
+
+	if first {
+		b.err = err
+	}
+
+	b.mu.Unlock()
+
+	if first {
+		b.fail(err)
+	}
+}
+
+func (b *bulkWriter) failed() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	return b.err != nil
+}
+
+// Write sends the fact to the next encoder.
+func (b *bulkWriter) Write(f *origins.Fact) {
+	b.workers[b.next] <- f
+	b.next = (b.next + 1) % len(b.workers)
+}
+
+// encode encodes facts into blocks and sends full blocks to the writer.
+func (b *bulkWriter) encode(ch chan *origins.Fact) {
+	defer b.wwg.Done()
+
+	enc := dal.NewBlockEncoder()
+
+	send := func() {
+		if enc.Count == 0 {
+			return
+		}
+
+		// The encoder buffer is reused, so the bytes are copied.
+		block := &encodedBlock{
+			bytes: append([]byte(nil), enc.Bytes()...),
+			count: enc.Count,
+		}
+
+		enc.Reset()
+
+		b.blocks <- block
+	}
+
+	for f := range ch {
+		// Discard the remaining facts once an error occurs.
+		if b.failed() {
+			continue
+		}
+
+		if err := enc.Write(f); err != nil {
+			b.setErr(err)
+			continue
+		}
+
+		if enc.Count == blockSize {
+			send()
+		}
+	}
+
+	send()
+}
+
+// commit writes the index entries of the facts in the flushed blocks and the
+// state of their entities in the storage transaction the segment is committed
+// in, so the facts do not become visible before the transaction commits.
+func (b *bulkWriter) commit(tx storage.Tx) error {
+	seg := b.segment
+
+	for i := 0; i < seg.Blocks; i++ {
+		block, err := dal.GetBlock(tx, seg.Domain, seg.UUID, i)
+
+		if err != nil {
+			return err
+		}
+
+		facts, err := origins.ReadAll(dal.NewBlockDecoder(block, seg.Domain, seg.Transaction))
+
+		if err != nil {
+			return err
+		}
+
+		for _, f := range facts {
+			if err = index.Write(tx, seg.Domain, f); err != nil {
+				return err
+			}
+		}
+
+		// Only new domains are loaded in bulk, so the index only holds
+		// the state of the blocks that were already applied.
+		if err = applyState(tx, seg.Domain, facts); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// flush writes the batch of blocks and the segment header in one storage
+// transaction.
+func (b *bulkWriter) flush(batch []*encodedBlock) error {
+	if len(batch) == 0 {
+		return nil
+	}
+
+	var size int
+
+	err := b.engine.Multi(func(tx storage.Tx) error {
+		seg := b.segment
+
+		for _, block := range batch {
+			n, err := dal.SetBlock(tx, seg.Domain, seg.UUID, seg.Blocks, block.bytes)
+
+			if err != nil {
+				return err
+			}
+
+			seg.Bytes += n
+			seg.Count += block.count
+			seg.Blocks++
+
+			size += n
+		}
+
+		_, err := dal.SetSegment(tx, seg.Domain, &seg.Segment)
+
+		return err
+	})
+
+	if err != nil {
+		return err
+	}
+
+	atomic.StoreInt64(b.nblocks, int64(b.segment.Blocks))
+
+	if b.progress != nil {
+		b.progress()
+	}
+
+	n := atomic.AddInt64(b.written, int64(size))
+
+	if b.maxBytes > 0 && n > int64(b.maxBytes) {
+		return &LimitError{
+			Limit: LimitBytes,
+			Max:   int64(b.maxBytes),
+		}
+	}
+
+	return nil
+}
+
+// write receives encoded blocks and writes them in batches.
+func (b *bulkWriter) write() {
+	defer b.bwg.Done()
+
+	batch := make([]*encodedBlock, 0, b.batch)
+
+	for block := range b.blocks {
+		if b.failed() {
+			continue
+		}
+
+		batch = append(batch, block)
+
+		if len(batch) < b.batch {
+			continue
+		}
+
+		if err := b.flush(batch); err != nil {
+			b.setErr(err)
+		}
+
+		batch = batch[:0]
+	}
+
+	if !b.failed() {
+		if err := b.flush(batch); err != nil {
+			b.setErr(err)
+		}
+	}
+}
+
+// Close waits for the remaining facts to be encoded and written.
+func (b *bulkWriter) Close() error {
+	for _, ch := range b.workers {
+		close(ch)
+	}
+
+	b.wwg.Wait()
+
+	close(b.blocks)
+
+	b.bwg.Wait()
+
+	logrus.Debugf("transactor.bulkWriter(%s): wrote %d blocks", b.segment.Domain, b.segment.Blocks)
+
+	return b.err
+}
+
+// newBulkWriter starts the encoder and writer goroutines for the pipeline.
+func newBulkWriter(p *Pipeline, tx *Transaction) *bulkWriter {
+	n := tx.options.BulkWorkers
+
+	if n <= 0 {
+		n = runtime.NumCPU()
+	}
+
+	b := &bulkWriter{
+		segment:  p.segment,
+		engine:   tx.Engine,
+		batch:    bulkBatchSize,
+		fail:     tx.fail,
+		written:  &tx.written,
+		maxBytes: tx.options.MaxBytes,
+		nblocks:  &p.nblocks,
+		progress: p.progress,
+		workers:  make([]chan *origins.Fact, n),
+		blocks:   make(chan *encodedBlock, n),
+	}
+
+	b.wwg.Add(n)
+
+	for i := range b.workers {
+		b.workers[i] = make(chan *origins.Fact, blockSize)
+		go b.encode(b.workers[i])
+	}
+
+	b.bwg.Add(1)
+	go b.write()
+
+	return b
+}
@@ -0,0 +1,224 @@
+package transactor
+
+import (
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/chop-dbhi/origins"
+	"github.com/chop-dbhi/origins/dal"
+	"github.com/chop-dbhi/origins/index"
+	"github.com/chop-dbhi/origins/storage"
+	"github.com/chop-dbhi/origins/testutil"
+	"github.com/chop-dbhi/origins/view"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBulkLoad(t *testing.T) {
+	engine, _ := origins.Init("mem", nil)
+
+	options := DefaultOptions
+	options.BulkLoad = true
+	options.BulkWorkers = 4
+
+	tx, _ := New(engine, options)
+
+	n := 25500
+
+	origins.Copy(testutil.NewRandGenerator("test", tx.ID, n), tx)
+
+	if err := tx.Commit(); err != nil {
+		t.Fatal(err)
+	}
+
+	checkCommitted(t, engine, "test", tx.ID)
+
+	stats := tx.pipes["test"].Stats()
+
+	assert.Equal(t, n, stats.Count)
+
+	// Each worker encodes 6375 facts into 6 full blocks and a partial one.
+	assert.Equal(t, 28, stats.Blocks)
+
+	log, _ := view.OpenLog(engine, "test", "commit")
+	facts, err := origins.ReadAll(log.Now())
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assert.Equal(t, n, len(facts))
+
+	// The state index is written with the facts, so the next transaction
+	// does not rebuild it to dedupe a loaded fact.
+	l := checkCommitted(t, engine, "test", tx.ID)
+	state, _ := dal.GetLog(engine, "test", stateLogName)
+
+	assert.Equal(t, l.Head, state.Head)
+
+	// The facts are indexed when the transaction commits.
+	ilog, _ := dal.GetLog(engine, "test", indexLogName)
+
+	assert.Equal(t, l.Head, ilog.Head)
+
+	indexed, err := origins.ReadAll(index.Scan(engine, "test", index.EAVT, index.Range{History: true}))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assert.Equal(t, n, len(indexed))
+
+	f := facts[0]
+
+	tx, _ = New(engine, DefaultOptions)
+
+	tx.Write(&origins.Fact{
+		Operation: f.Operation,
+		Domain:    "test",
+		Entity:    f.Entity,
+		Attribute: f.Attribute,
+		Value:     f.Value,
+	})
+
+	if err := tx.Commit(); err != nil {
+		t.Fatal(err)
+	}
+
+	assert.Equal(t, 0, tx.pipes["test"].Stats().Count)
+	assert.False(t, tx.pipes["test"].rebuilt)
+}
+
+func TestBulkLoadExisting(t *testing.T) {
+	engine, _ := origins.Init("mem", nil)
+
+	options := DefaultOptions
+	options.DefaultDomain = "test"
+
+	transactCSV(t, engine, options, `
+entity,attribute,value
+bob,city,Norristown
+`)
+
+	options.BulkLoad = true
+
+	tx, _ := New(engine, options)
+
+	origins.Copy(testutil.NewRandGenerator("test", tx.ID, 100), tx)
+
+	assert.Equal(t, ErrBulkExisting, tx.Commit())
+}
+
+func TestBulkLoadAbort(t *testing.T) {
+	engine, _ := origins.Init("mem", nil)
+
+	options := DefaultOptions
+	options.BulkLoad = true
+	options.MaxBytes = 50000
+
+	tx, _ := New(engine, options)
+
+	origins.Copy(testutil.NewRandGenerator("test", tx.ID, 20000), tx)
+
+	err := tx.Commit()
+
+	if _, ok := err.(*LimitError); !ok {
+		t.Fatalf("expected limit error, got %v", err)
+	}
+
+	checkCanceled(t, engine, "test", tx.ID)
+
+	// The flushed facts were not indexed.
+	indexed, _ := origins.ReadAll(index.Scan(engine, "test", index.EAVT, index.Range{History: true}))
+
+	assert.Equal(t, 0, len(indexed))
+}
+
+func TestBulkLoadUncommitted(t *testing.T) {
+	engine, _ := origins.Init("mem", nil)
+
+	options := DefaultOptions
+	options.DefaultDomain = "test"
+	options.BulkLoad = true
+	options.BulkWorkers = 1
+
+	tx, _ := New(engine, options)
+
+	// Enough facts for a batch of blocks to be flushed.
+	for i := 0; i < bulkBatchSize*blockSize; i++ {
+		tx.Write(&origins.Fact{
+			Entity: &origins.Ident{
+				Name: strconv.Itoa(i),
+			},
+			Attribute: &origins.Ident{
+				Name: "name",
+			},
+			Value: &origins.Ident{
+				Name: strconv.Itoa(i),
+			},
+		})
+	}
+
+	deadline := time.Now().Add(5 * time.Second)
+
+	for tx.Progress().Blocks == 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("blocks were not flushed")
+		}
+
+		time.Sleep(time.Millisecond)
+	}
+
+	entity := &origins.Ident{
+		Domain: "test",
+		Name:   "0",
+	}
+
+	// The flushed facts are not visible until the transaction commits.
+	state, _ := dal.GetState(engine, "test", entity)
+
+	assert.Equal(t, 0, len(state))
+
+	indexed, _ := origins.ReadAll(index.Scan(engine, "test", index.EAVT, index.Range{History: true}))
+
+	assert.Equal(t, 0, len(indexed))
+
+	if err := tx.Commit(); err != nil {
+		t.Fatal(err)
+	}
+
+	state, _ = dal.GetState(engine, "test", entity)
+
+	assert.Equal(t, 1, len(state))
+}
+
+func benchmarkTransact(b *testing.B, options Options) {
+	var engine storage.Engine
+
+	n := 10000
+
+	for i := 0; i < b.N; i++ {
+		b.StopTimer()
+		engine, _ = origins.Init("mem", nil)
+		tx, _ := New(engine, options)
+		gen := testutil.NewRandGenerator("test", tx.ID, n)
+		b.StartTimer()
+
+		origins.Copy(gen, tx)
+
+		if err := tx.Commit(); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkTransact(b *testing.B) {
+	benchmarkTransact(b, DefaultOptions)
+}
+
+func BenchmarkTransactBulk(b *testing.B) {
+	options := DefaultOptions
+	options.BulkLoad = true
+
+	benchmarkTransact(b, options)
+}
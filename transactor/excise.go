@@ -0,0 +1,376 @@
+package transactor
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/chop-dbhi/origins"
+	"github.com/chop-dbhi/origins/dal"
+	"github.com/chop-dbhi/origins/index"
+	"github.com/chop-dbhi/origins/storage"
+)
+
+// Excision describes the facts to permanently remove from a domain.
+type Excision struct {
+	// Domain the facts are stored in.
+	Domain string
+
+	// Entity the facts are about.
+	Entity *origins.Ident
+
+	// If defined, only facts with the attribute are excised.
+	Attribute *origins.Ident
+
+	// If defined, only facts transacted in the time range are excised.
+	Since time.Time
+	Asof  time.Time
+}
+
+// match returns true if the fact is excised.
+func (e *Excision) match(f *origins.Fact) bool {
+	if !f.Entity.Is(e.Entity) {
+		return false
+	}
+
+	if e.Attribute != nil && !f.Attribute.Is(e.Attribute) {
+		return false
+	}
+
+	return true
+}
+
+// inRange returns true if the segment was committed in the time range.
+func (e *Excision) inRange(seg *dal.Segment) bool {
+	if !e.Asof.IsZero() && seg.Time.After(e.Asof) {
+		return false
+	}
+
+	if !e.Since.IsZero() && seg.Time.Before(e.Since) {
+		return false
+	}
+
+	return true
+}
+
+// rewrite removes the excised facts from the segment and writes the remaining
+// facts to compacted blocks. The facts that remain for the entity are returned
+// along with the number of facts that were removed.
+func (e *Excision) rewrite(tx storage.Tx, seg *dal.Segment) (origins.Facts, int, error) {
+	var (
+		kept   origins.Facts
+		entity origins.Facts
+	)
+
+	for i := 0; i < seg.Blocks; i++ {
+		block, err := dal.GetBlock(tx, seg.Domain, seg.UUID, i)
+
+		if err != nil {
+			return nil, 0, err
+		}
+
+		facts, err := origins.ReadAll(dal.NewBlockDecoder(block, seg.Domain, seg.Transaction))
+
+		if err != nil {
+			return nil, 0, err
+		}
+
+		for _, f := range facts {
+			if e.inRange(seg) && e.match(f) {
+				if err = index.Delete(tx, seg.Domain, f); err != nil {
+					return nil, 0, err
+				}
+
+				continue
+			}
+
+			kept = append(kept, f)
+
+			if f.Entity.Is(e.Entity) {
+				entity = append(entity, f)
+			}
+		}
+	}
+
+	removed := seg.Count - len(kept)
+
+	if removed == 0 {
+		return entity, 0, nil
+	}
+
+	blocks := seg.Blocks
+
+	seg.Blocks = 0
+	seg.Count = 0
+	seg.Bytes = 0
+
+	enc := dal.NewBlockEncoder()
+
+	for i, f := range kept {
+		if err := enc.Write(f); err != nil {
+			return nil, 0, err
+		}
+
+		if enc.Count < blockSize && i+1 < len(kept) {
+			continue
+		}
+
+		size, err := dal.SetBlock(tx, seg.Domain, seg.UUID, seg.Blocks, enc.Bytes())
+
+		if err != nil {
+			return nil, 0, err
+		}
+
+		seg.Bytes += size
+		seg.Count += enc.Count
+		seg.Blocks++
+
+		enc.Reset()
+	}
+
+	// Remove the trailing blocks that are no longer used.
+	for i := seg.Blocks; i < blocks; i++ {
+		if err := dal.DeleteBlock(tx, seg.Domain, seg.UUID, i); err != nil {
+			return nil, 0, err
+		}
+	}
+
+	if _, err := dal.SetSegment(tx, seg.Domain, seg); err != nil {
+		return nil, 0, err
+	}
+
+	return entity, removed, nil
+}
+
+// count returns the number of facts in the commit log that are excised.
+func (e *Excision) count(tx storage.Tx) (int, error) {
+	log, err := dal.GetLog(tx, e.Domain, commitLogName)
+
+	if err != nil || log == nil {
+		return 0, err
+	}
+
+	var count int
+
+	for id := log.Head; id != nil; {
+		seg, err := dal.GetSegment(tx, e.Domain, id)
+
+		if err != nil {
+			return 0, err
+		}
+
+		if seg == nil {
+			return 0, fmt.Errorf("transactor: segment %s does not exist", id)
+		}
+
+		id = seg.Next
+
+		if !e.inRange(seg) {
+			continue
+		}
+
+		for i := 0; i < seg.Blocks; i++ {
+			block, err := dal.GetBlock(tx, seg.Domain, seg.UUID, i)
+
+			if err != nil {
+				return 0, err
+			}
+
+			facts, err := origins.ReadAll(dal.NewBlockDecoder(block, seg.Domain, seg.Transaction))
+
+			if err != nil {
+				return 0, err
+			}
+
+			for _, f := range facts {
+				if e.match(f) {
+					count++
+				}
+			}
+		}
+	}
+
+	return count, nil
+}
+
+// excise removes the facts from the segments of the commit log and rebuilds
+// the entity entry in the current-state index from the remaining facts.
+func (e *Excision) excise(tx storage.Tx) (int, error) {
+	log, err := dal.GetLog(tx, e.Domain, commitLogName)
+
+	if err != nil {
+		return 0, err
+	}
+
+	if log == nil {
+		return 0, nil
+	}
+
+	var (
+		count  int
+		facts  origins.Facts
+		latest origins.Facts
+	)
+
+	for id := log.Head; id != nil; {
+		seg, err := dal.GetSegment(tx, e.Domain, id)
+
+		if err != nil {
+			return 0, err
+		}
+
+		if seg == nil {
+			return 0, fmt.Errorf("transactor: segment %s does not exist", id)
+		}
+
+		remaining, n, err := e.rewrite(tx, seg)
+
+		if err != nil {
+			return 0, err
+		}
+
+		count += n
+		facts = append(facts, remaining...)
+
+		id = seg.Next
+	}
+
+	if count == 0 {
+		return 0, nil
+	}
+
+	// Only keep the most recent fact for each attribute/value pair.
+	origins.Timsort(facts, origins.EAVTComparator)
+
+	for i, f := range facts {
+		if i+1 < len(facts) && f.Attribute.Is(facts[i+1].Attribute) && f.Value.Is(facts[i+1].Value) {
+			continue
+		}
+
+		latest = append(latest, f)
+	}
+
+	if len(latest) == 0 {
+		err = dal.DeleteState(tx, e.Domain, e.Entity)
+	} else {
+		_, err = dal.SetState(tx, e.Domain, e.Entity, latest)
+	}
+
+	return count, err
+}
+
+// Excise permanently removes the facts described by the excision from storage.
+// The affected blocks and segments are rewritten in place. If any facts are
+// removed, a transaction that records the domain and number of facts excised,
+// but not the excised content itself, is committed along with the excision.
+// The number of facts removed is returned.
+//
+// Excision rewrites committed data and should not be run while transactions
+// that write to the domain are in progress.
+func Excise(engine storage.Engine, ex Excision) (int, error) {
+	if ex.Domain == "" {
+		return 0, ErrNoDomain
+	}
+
+	if ex.Entity == nil || ex.Entity.Name == "" {
+		return 0, ErrNoEntity
+	}
+
+	if ex.Entity.Domain == "" {
+		ex.Entity = &origins.Ident{
+			Domain: ex.Domain,
+			Name:   ex.Entity.Name,
+		}
+	}
+
+	var count int
+
+	err := engine.Multi(func(tx storage.Tx) error {
+		var err error
+		count, err = ex.count(tx)
+		return err
+	})
+
+	if err != nil {
+		return 0, err
+	}
+
+	if count == 0 {
+		return 0, nil
+	}
+
+	// The audit facts are written to the transactions domain.
+	options := DefaultOptions
+	options.Privileged = true
+
+	tx, err := New(engine, options)
+
+	if err != nil {
+		return 0, err
+	}
+
+	// The facts are excised in the same storage transaction the audit facts
+	// are committed in, so neither is written without the other.
+	tx.prepare = func(etx storage.Tx) error {
+		n, err := ex.excise(etx)
+
+		if err != nil {
+			return err
+		}
+
+		if n != count {
+			return ErrExcisionChanged
+		}
+
+		logrus.Debugf("transactor: excised %d facts from %s", count, ex.Domain)
+
+		return nil
+	}
+
+	// The macro is expanded in place, so each fact gets its own ident.
+	entity := func() *origins.Ident {
+		return &origins.Ident{
+			Domain: origins.MacrosDomain,
+			Name:   "tx",
+		}
+	}
+
+	facts := origins.Facts{
+		{
+			Domain: origins.TransactionsDomain,
+			Entity: entity(),
+			Attribute: &origins.Ident{
+				Name: "excised",
+			},
+			Value: &origins.Ident{
+				Domain: origins.DomainsDomain,
+				Name:   ex.Domain,
+			},
+		},
+		{
+			Domain: origins.TransactionsDomain,
+			Entity: entity(),
+			Attribute: &origins.Ident{
+				Name: "excisedCount",
+			},
+			Value: &origins.Ident{
+				Name: fmt.Sprint(count),
+			},
+		},
+	}
+
+	if _, err = origins.Copy(origins.NewBuffer(facts), tx); err != nil {
+		tx.Cancel()
+		return 0, err
+	}
+
+	if err = tx.Commit(); err != nil {
+		return 0, err
+	}
+
+	if tx.CommitError != nil {
+		return 0, tx.CommitError
+	}
+
+	return count, nil
+}
@@ -0,0 +1,122 @@
+package transactor
+
+import (
+	"fmt"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/chop-dbhi/origins"
+	"github.com/chop-dbhi/origins/dal"
+	"github.com/chop-dbhi/origins/index"
+	"github.com/chop-dbhi/origins/storage"
+	"github.com/satori/go.uuid"
+)
+
+// indexSegment adds the facts of the segment to the indexes of its domain.
+func indexSegment(tx storage.Tx, seg *dal.Segment) error {
+	for i := 0; i < seg.Blocks; i++ {
+		block, err := dal.GetBlock(tx, seg.Domain, seg.UUID, i)
+
+		if err != nil {
+			return err
+		}
+
+		err = origins.Map(dal.NewBlockDecoder(block, seg.Domain, seg.Transaction), func(f *origins.Fact) error {
+			return index.Write(tx, seg.Domain, f)
+		})
+
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// indexLog adds the segments of the commit log that have not been indexed to
+// the indexes of the domain. This is normally only the segment that was just
+// committed, but includes earlier segments if the domain was written to before
+// the indexes were introduced.
+func indexLog(tx storage.Tx, domain string) error {
+	log, err := dal.GetLog(tx, domain, commitLogName)
+
+	if err != nil || log == nil {
+		return err
+	}
+
+	ilog, err := dal.GetLog(tx, domain, indexLogName)
+
+	if err != nil {
+		return err
+	}
+
+	if ilog == nil {
+		ilog = &dal.Log{
+			Name:   indexLogName,
+			Domain: domain,
+		}
+	}
+
+	var (
+		n   int
+		seg *dal.Segment
+	)
+
+	for id := log.Head; id != nil && !sameUUID(id, ilog.Head); id = seg.Next {
+		if seg, err = dal.GetSegment(tx, domain, id); err != nil {
+			return err
+		}
+
+		if seg == nil {
+			return fmt.Errorf("transactor: segment %s does not exist", id)
+		}
+
+		if err = indexSegment(tx, seg); err != nil {
+			return err
+		}
+
+		n++
+	}
+
+	if n > 1 {
+		logrus.Debugf("transactor: indexed %d segments of %s", n, domain)
+	}
+
+	ilog.Head = log.Head
+
+	_, err = dal.SetLog(tx, domain, ilog)
+
+	return err
+}
+
+// setIndexed sets the head of the index log to the segment whose facts have
+// already been indexed, such as those written in bulk.
+func setIndexed(tx storage.Tx, domain string, head *uuid.UUID) error {
+	ilog, err := dal.GetLog(tx, domain, indexLogName)
+
+	if err != nil {
+		return err
+	}
+
+	if ilog == nil {
+		ilog = &dal.Log{
+			Name:   indexLogName,
+			Domain: domain,
+		}
+	}
+
+	ilog.Head = head
+
+	_, err = dal.SetLog(tx, domain, ilog)
+
+	return err
+}
+
+// Reindex brings the indexes of the domain up to date with its commit log.
+// Indexes are maintained when transactions are committed, so this is only
+// necessary for domains that have not been written to since the indexes
+// were introduced.
+func Reindex(engine storage.Engine, domain string) error {
+	return engine.Multi(func(tx storage.Tx) error {
+		return indexLog(tx, domain)
+	})
+}
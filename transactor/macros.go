@@ -0,0 +1,333 @@
+package transactor
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"text/template"
+	"time"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/chop-dbhi/origins"
+	"github.com/chop-dbhi/origins/dal"
+	"github.com/chop-dbhi/origins/storage"
+	"github.com/chop-dbhi/origins/view"
+	"github.com/satori/go.uuid"
+)
+
+// Macro expands a macro in a fact. The argument is the portion of the macro
+// name after the first period, for example HOST in origins.macros/env.HOST.
+// Macros are registered with RegisterEntityMacro and RegisterValueMacro.
+// Entity macros are expected to set the entity (and optionally the domain) of
+// the fact and value macros are expected to set the value.
+type Macro func(tx *Transaction, fact *origins.Fact, arg string) error
+
+// macrosMu guards the registered macros and the allowed environment variables.
+var macrosMu sync.RWMutex
+
+// Registered entity macros keyed by name.
+var entityMacros = map[string]Macro{
+	// Facts about the domain.
+	"domain": func(tx *Transaction, fact *origins.Fact, arg string) error {
+		fact.Entity.Name = fact.Domain
+		fact.Domain = origins.DomainsDomain
+		fact.Entity.Domain = ""
+		return nil
+	},
+
+	// Facts about the transaction.
+	"tx": func(tx *Transaction, fact *origins.Fact, arg string) error {
+		fact.Domain = origins.TransactionsDomain
+		fact.Entity.Domain = ""
+		fact.Entity.Name = fmt.Sprint(tx.ID)
+		return nil
+	},
+}
+
+// Registered value macros keyed by name.
+var valueMacros = map[string]Macro{
+	// Set the value to the transaction time.
+	"now": func(tx *Transaction, fact *origins.Fact, arg string) error {
+		fact.Value.Domain = ""
+		fact.Value.Name = tx.StartTime.String()
+		return nil
+	},
+
+	// Set the value to the date of the transaction.
+	"today": func(tx *Transaction, fact *origins.Fact, arg string) error {
+		fact.Value.Domain = ""
+		fact.Value.Name = tx.StartTime.Format("2006-01-02")
+		return nil
+	},
+
+	// Set the value to the transaction entity.
+	"tx": func(tx *Transaction, fact *origins.Fact, arg string) error {
+		fact.Value.Domain = origins.TransactionsDomain
+		fact.Value.Name = fmt.Sprint(tx.ID)
+		return nil
+	},
+
+	// Set the value to a new random UUID.
+	"uuid": func(tx *Transaction, fact *origins.Fact, arg string) error {
+		fact.Value.Domain = ""
+		fact.Value.Name = uuid.NewV4().String()
+		return nil
+	},
+
+	// Set the value to an allowed environment variable of the transactor
+	// process.
+	"env": func(tx *Transaction, fact *origins.Fact, arg string) error {
+		v, err := getenv(arg)
+
+		if err != nil {
+			return fmt.Errorf("transactor(%d): %s", tx.ID, err)
+		}
+
+		fact.Value.Domain = ""
+		fact.Value.Name = v
+		return nil
+	},
+}
+
+// Environment variables the env macro and template function may read.
+var allowedEnv = make(map[string]struct{})
+
+// RegisterEntityMacro registers an entity macro under the name. A macro
+// previously registered under the name is replaced.
+func RegisterEntityMacro(name string, m Macro) {
+	macrosMu.Lock()
+	entityMacros[name] = m
+	macrosMu.Unlock()
+}
+
+// RegisterValueMacro registers a value macro under the name. A macro
+// previously registered under the name is replaced.
+func RegisterValueMacro(name string, m Macro) {
+	macrosMu.Lock()
+	valueMacros[name] = m
+	macrosMu.Unlock()
+}
+
+// AllowEnv permits the env macro and template function to read the
+// environment variables. None are allowed by default since any client that
+// can write facts could otherwise record the secrets of the process.
+func AllowEnv(names ...string) {
+	macrosMu.Lock()
+
+	for _, name := range names {
+		allowedEnv[name] = struct{}{}
+	}
+
+	macrosMu.Unlock()
+}
+
+// getenv returns the value of the environment variable if it is allowed
+// and set.
+func getenv(name string) (string, error) {
+	macrosMu.RLock()
+	_, ok := allowedEnv[name]
+	macrosMu.RUnlock()
+
+	if !ok {
+		return "", fmt.Errorf("environment variable not allowed: %s", name)
+	}
+
+	v, ok := os.LookupEnv(name)
+
+	if !ok {
+		return "", fmt.Errorf("environment variable not set: %s", name)
+	}
+
+	return v, nil
+}
+
+// lookupMacro returns the macro for the name and the argument to pass to it.
+// An exact match takes precedence over a match on the name before the first
+// period.
+func lookupMacro(macros map[string]Macro, name string) (Macro, string) {
+	macrosMu.RLock()
+	defer macrosMu.RUnlock()
+
+	if m, ok := macros[name]; ok {
+		return m, ""
+	}
+
+	toks := strings.SplitN(name, ".", 2)
+
+	if len(toks) == 2 {
+		if m, ok := macros[toks[0]]; ok {
+			return m, toks[1]
+		}
+	}
+
+	return nil, ""
+}
+
+// templateFuncs are the functions available to template macros.
+var templateFuncs = template.FuncMap{
+	"env": getenv,
+}
+
+// templateData is the data a template macro is executed with.
+type templateData struct {
+	Tx        uint64
+	Time      time.Time
+	Domain    string
+	Entity    *origins.Ident
+	Attribute *origins.Ident
+}
+
+// templateCache holds the template macros last loaded and the engine and
+// head of the macros log they were loaded as of. Only the most recently
+// loaded templates are kept.
+type templateCache struct {
+	engine    storage.Engine
+	head      uuid.UUID
+	templates map[string]*template.Template
+}
+
+var (
+	templatesMu     sync.Mutex
+	cachedTemplates *templateCache
+)
+
+// loadTemplates returns the template macros declared in the macros domain.
+// They are only read from the log when its head has changed since they were
+// last loaded.
+func loadTemplates(engine storage.Engine) (map[string]*template.Template, error) {
+	log, err := dal.GetLog(engine, origins.MacrosDomain, commitLogName)
+
+	if err != nil {
+		return nil, err
+	}
+
+	// No macros have been declared.
+	if log == nil || log.Head == nil {
+		return make(map[string]*template.Template), nil
+	}
+
+	templatesMu.Lock()
+	c := cachedTemplates
+	templatesMu.Unlock()
+
+	if c != nil && c.engine == engine && uuid.Equal(c.head, *log.Head) {
+		return c.templates, nil
+	}
+
+	t, err := readTemplates(engine)
+
+	if err != nil {
+		return nil, err
+	}
+
+	templatesMu.Lock()
+	cachedTemplates = &templateCache{
+		engine:    engine,
+		head:      *log.Head,
+		templates: t,
+	}
+	templatesMu.Unlock()
+
+	return t, nil
+}
+
+// readTemplates reads the template macros declared in the macros domain.
+// A template macro is declared by asserting the template attribute on an
+// entity in the macros domain, for example:
+//
+//	domain,entity,attribute,value
+//	origins.macros,site,template,{{env "SITE"}}-{{.Tx}}
+//
+// The expanded template is used as the name of the entity or value. The env
+// function only reads the environment variables allowed by AllowEnv.
+func readTemplates(engine storage.Engine) (map[string]*template.Template, error) {
+	templates := make(map[string]*template.Template)
+
+	log, err := view.OpenLog(engine, origins.MacrosDomain, commitLogName)
+
+	// No macros have been declared.
+	if err == view.ErrDoesNotExist {
+		return templates, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	seen := make(map[string]struct{})
+
+	// The log is read newest first, so only the first fact for each
+	// macro is considered.
+	err = origins.Map(log.Now(), func(f *origins.Fact) error {
+		if f.Attribute.Domain != origins.MacrosDomain || f.Attribute.Name != "template" {
+			return nil
+		}
+
+		name := f.Entity.Name
+
+		if _, ok := seen[name]; ok {
+			return nil
+		}
+
+		seen[name] = struct{}{}
+
+		if f.Operation == origins.Retraction {
+			return nil
+		}
+
+		t, err := template.New(name).Funcs(templateFuncs).Parse(f.Value.Name)
+
+		if err != nil {
+			logrus.Warnf("transactor: invalid template macro %s: %s", name, err)
+			return nil
+		}
+
+		templates[name] = t
+
+		return nil
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	return templates, nil
+}
+
+// expand resolves the entity or value macro in the fact.
+func (tx *Transaction) expand(macros map[string]Macro, kind string, fact *origins.Fact, ident *origins.Ident) error {
+	if m, arg := lookupMacro(macros, ident.Name); m != nil {
+		return m(tx, fact, arg)
+	}
+
+	t, ok := tx.templates[ident.Name]
+
+	if !ok {
+		return fmt.Errorf("transactor(%d): unknown %s macro: %s", tx.ID, kind, ident.Name)
+	}
+
+	var buf bytes.Buffer
+
+	err := t.Execute(&buf, &templateData{
+		Tx:        tx.ID,
+		Time:      tx.StartTime,
+		Domain:    fact.Domain,
+		Entity:    fact.Entity,
+		Attribute: fact.Attribute,
+	})
+
+	if err != nil {
+		return fmt.Errorf("transactor(%d): %s macro %s: %s", tx.ID, kind, ident.Name, err)
+	}
+
+	// Expanded entities belong to the fact domain and values are literals.
+	if kind == "entity" {
+		ident.Domain = fact.Domain
+	} else {
+		ident.Domain = ""
+	}
+
+	ident.Name = buf.String()
+
+	return nil
+}
@@ -1,16 +1,45 @@
 package transactor
 
 import (
+	"strings"
+	"sync/atomic"
+	"time"
+
 	"github.com/Sirupsen/logrus"
 	"github.com/Workiva/go-datastructures/trie/ctrie"
 	"github.com/chop-dbhi/origins"
 	"github.com/chop-dbhi/origins/dal"
+	"github.com/chop-dbhi/origins/index"
+	"github.com/chop-dbhi/origins/schema"
 	"github.com/chop-dbhi/origins/storage"
 	"github.com/chop-dbhi/origins/view"
 	"github.com/satori/go.uuid"
 )
 
-const commitLogName = "commit"
+const (
+	commitLogName = "commit"
+
+	// Attribute in the origins.attrs domain that declares the cardinality
+	// of an attribute.
+	cardinalityAttr = "cardinality"
+
+	// The state log points to the segment the current-state index of the
+	// domain was last updated with.
+	stateLogName = "state"
+
+	// The index log points to the segment the indexes of the domain were
+	// last updated with.
+	indexLogName = index.LogName
+)
+
+// Domains whose entities are specific to a transaction or to a transacted
+// domain. Concurrent transactions on disjoint domains do not write the same
+// entities, so rather than failing with a conflict, the segment is rebased
+// onto the head of the log.
+var rebaseDomains = map[string]struct{}{
+	origins.DomainsDomain:      struct{}{},
+	origins.TransactionsDomain: struct{}{},
+}
 
 // Stats contains information about a pipeline.
 type Stats struct {
@@ -28,13 +57,58 @@ type Stats struct {
 
 // A Pipeline does the actual work of processing and writing facts to storage.
 type Pipeline struct {
-	Domain      string
-	receiver    chan *origins.Fact
-	segment     *Segment
-	engine      storage.Engine
-	cache       *ctrie.Ctrie
-	initialized bool
-	dedupe      bool
+	Domain   string
+	receiver chan *origins.Fact
+	segment  *Segment
+	engine   storage.Engine
+
+	// Read-through cache of the current-state index keyed by entity.
+	cache *ctrie.Ctrie
+
+	// Entities whose state changed during the transaction.
+	dirty map[string]*origins.Ident
+
+	// Facts written about entities whose state has not been read yet.
+	pending map[string]origins.Facts
+
+	// True if the domain has no commits, so no entity has any state.
+	empty bool
+
+	// Attributes whose cardinality has been looked up keyed by identity.
+	// True if the attribute is explicitly declared with a cardinality of one.
+	ones map[string]bool
+
+	cardinalities map[string]schema.Cardinality
+	rebuild       bool
+	rebuilt       bool
+	rebased       bool
+	dedupe        bool
+
+	// Bytes written by the transaction and the maximum allowed.
+	written  *int64
+	maxBytes int
+
+	// Number of facts written and blocks flushed. These are read
+	// concurrently to report progress.
+	nfacts  int64
+	nblocks int64
+
+	// If defined, called each time a block is flushed to report the
+	// progress of the transaction.
+	progress func()
+
+	// Writes the facts in bulk rather than through the segment.
+	bulk *bulkWriter
+
+	// Facts written and the state of the entities prior to the transaction.
+	// These are only kept when previewing a transaction.
+	preview bool
+	facts   origins.Facts
+	prior   map[string]origins.Facts
+
+	// Retractions implied by asserting a new value for an attribute with a
+	// cardinality of one.
+	implied map[*origins.Fact]struct{}
 }
 
 func (p *Pipeline) String() string {
@@ -43,6 +117,13 @@ func (p *Pipeline) String() string {
 
 // Stats returns the the stats for the pipeline.
 func (p *Pipeline) Stats() *Stats {
+	// The pipeline failed to initialize.
+	if p.segment == nil {
+		return &Stats{
+			Domain: p.Domain,
+		}
+	}
+
 	return &Stats{
 		Domain: p.Domain,
 		Blocks: p.segment.Blocks,
@@ -51,17 +132,37 @@ func (p *Pipeline) Stats() *Stats {
 	}
 }
 
-func (p *Pipeline) initCache() error {
-	logrus.Debugf("transactor.Pipeline(%s): initializing cache", p.Domain)
+// Progress returns the number of facts written and blocks flushed by the
+// pipeline. It is safe to call while the pipeline is running.
+func (p *Pipeline) Progress() *DomainProgress {
+	return &DomainProgress{
+		Domain:  p.Domain,
+		Written: int(atomic.LoadInt64(&p.nfacts)),
+		Blocks:  int(atomic.LoadInt64(&p.nblocks)),
+	}
+}
+
+// sameUUID returns true if both IDs are nil or equal.
+func sameUUID(a, b *uuid.UUID) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+
+	return uuid.Equal(*a, *b)
+}
+
+// rebuildState builds the current-state index from the full log. This is
+// only necessary if the index is missing or out of date, such as for domains
+// written to before the index was introduced. All entities are marked dirty so
+// the index is written on commit.
+func (p *Pipeline) rebuildState() error {
+	logrus.Debugf("transactor.Pipeline(%s): rebuilding state index", p.Domain)
 
-	p.initialized = true
+	p.rebuilt = true
 
 	log, err := view.OpenLog(p.engine, p.Domain, commitLogName)
 
-	// This denotes the domain is new.
-	if err == view.ErrDoesNotExist {
-		return nil
-	} else if err != nil {
+	if err != nil {
 		return err
 	}
 
@@ -71,7 +172,8 @@ func (p *Pipeline) initCache() error {
 		return err
 	}
 
-	// Sort facts by entity.
+	// Sort facts by entity. Facts with the same entity, attribute and value
+	// are ordered by transaction, so the last one is the most recent.
 	origins.Timsort(facts, origins.EAVTComparator)
 
 	// Group the facts by entity.
@@ -79,17 +181,316 @@ func (p *Pipeline) initCache() error {
 		return f1.Entity.Is(f2.Entity)
 	})
 
-	// Initializing ctrie.
-	cache := ctrie.New(nil)
-
 	err = origins.MapFacts(giter, func(facts origins.Facts) error {
-		cache.Insert([]byte(facts[0].Entity.Name), facts)
+		var latest origins.Facts
+
+		// Only keep the most recent fact for each attribute/value pair.
+		for i, f := range facts {
+			if i+1 < len(facts) && f.Attribute.Is(facts[i+1].Attribute) && f.Value.Is(facts[i+1].Value) {
+				continue
+			}
+
+			latest = append(latest, f)
+		}
+
+		key := facts[0].Entity.String()
+
+		p.cache.Insert([]byte(key), latest)
+		p.dirty[key] = facts[0].Entity
+
 		return nil
 	})
 
-	p.cache = cache
+	logrus.Debugf("transactor.Pipeline(%s): state index rebuilt", p.Domain)
+
+	return err
+}
+
+// lookup returns the current state of the entity.
+func (p *Pipeline) lookup(entity *origins.Ident) (origins.Facts, error) {
+	return p.load(p.engine, entity)
+}
+
+// load returns the current state of the entity read through the cache. Facts
+// written about the entity before its state was read are applied to it.
+func (p *Pipeline) load(tx storage.Tx, entity *origins.Ident) (origins.Facts, error) {
+	key := entity.String()
+
+	if value, ok := p.cache.Lookup([]byte(key)); ok {
+		return value.(origins.Facts), nil
+	}
+
+	var facts origins.Facts
+
+	// The full index is in memory or the domain is new, so the entity
+	// does not exist.
+	if !p.rebuilt && !p.empty {
+		var err error
+
+		if facts, err = dal.GetState(tx, p.Domain, entity); err != nil {
+			return nil, err
+		}
+	}
+
+	for _, f := range p.pending[key] {
+		facts = replace(facts, f)
+	}
+
+	delete(p.pending, key)
+
+	p.cache.Insert([]byte(key), facts)
+
+	return facts, nil
+}
+
+// replace replaces the fact about the same attribute/value pair or appends it.
+func replace(facts origins.Facts, fact *origins.Fact) origins.Facts {
+	for i, f := range facts {
+		if f.Attribute.Is(fact.Attribute) && f.Value.Is(fact.Value) {
+			facts[i] = fact
+			return facts
+		}
+	}
+
+	return append(facts, fact)
+}
+
+// update replaces the previous fact about the same attribute/value pair for
+// the entity and marks the entity as dirty. If the state of the entity has not
+// been read, the fact is applied when it is.
+func (p *Pipeline) update(fact *origins.Fact) error {
+	key := fact.Entity.String()
+
+	// The entity is an attribute whose schema is changing.
+	if fact.Attribute.Domain == origins.AttrsDomain {
+		delete(p.ones, key)
+	}
+
+	p.dirty[key] = fact.Entity
+
+	if _, ok := p.cache.Lookup([]byte(key)); !ok && !p.preview {
+		p.pending[key] = append(p.pending[key], fact)
+		return nil
+	}
+
+	facts, err := p.lookup(fact.Entity)
+
+	if err != nil {
+		return err
+	}
+
+	if p.preview {
+		if _, ok := p.prior[key]; !ok {
+			p.prior[key] = append(origins.Facts(nil), facts...)
+		}
+	}
+
+	p.cache.Insert([]byte(key), replace(facts, fact))
+
+	return nil
+}
+
+// one returns true if the attribute has a cardinality of one. Cardinalities
+// supplied in the transaction options take precedence over the domain schema.
+// Otherwise the attribute must be declared with a cardinality of
+// origins.cardinalities/one. Attributes that are not declared or are only
+// declared with other options, such as a label, have many values.
+func (p *Pipeline) one(ident *origins.Ident) (bool, error) {
+	key := ident.String()
+
+	if c, ok := p.cardinalities[key]; ok {
+		return c == schema.One, nil
+	}
+
+	if one, ok := p.ones[key]; ok {
+		return one, nil
+	}
+
+	facts, err := p.lookup(ident)
+
+	if err != nil {
+		return false, err
+	}
+
+	// The most recently asserted cardinality applies.
+	var decl *origins.Fact
+
+	for _, f := range facts {
+		if f.Operation != origins.Assertion || f.Attribute.Domain != origins.AttrsDomain || f.Attribute.Name != cardinalityAttr {
+			continue
+		}
+
+		if f.Value.Domain != origins.CardinalitiesDomain {
+			continue
+		}
+
+		if decl == nil || f.Transaction >= decl.Transaction {
+			decl = f
+		}
+	}
+
+	one := decl != nil && strings.ToLower(decl.Value.Name) == "one"
+
+	p.ones[key] = one
+
+	return one, nil
+}
+
+// write writes the fact to the segment and updates the state of the entity.
+func (p *Pipeline) write(fact *origins.Fact) error {
+	fact.Transaction = p.segment.Transaction
+
+	size := p.segment.Size()
+	blocks := p.segment.Blocks
+
+	if err := p.segment.Write(fact); err != nil {
+		return err
+	}
+
+	atomic.AddInt64(&p.nfacts, 1)
+	atomic.StoreInt64(&p.nblocks, int64(p.segment.Blocks))
+
+	if p.progress != nil && p.segment.Blocks > blocks {
+		p.progress()
+	}
+
+	// Bytes written across all pipelines of the transaction.
+	n := atomic.AddInt64(p.written, int64(p.segment.Size()-size))
+
+	if p.maxBytes > 0 && n > int64(p.maxBytes) {
+		return &LimitError{
+			Limit: LimitBytes,
+			Max:   int64(p.maxBytes),
+		}
+	}
+
+	if p.preview {
+		p.facts = append(p.facts, fact)
+	}
+
+	return p.update(fact)
+}
+
+// applyState applies the facts to the state of their entities in the
+// current-state index.
+func applyState(tx storage.Tx, domain string, written origins.Facts) error {
+	var (
+		keys     []string
+		entities = make(map[string]origins.Facts)
+	)
+
+	for _, f := range written {
+		key := f.Entity.String()
+
+		if _, ok := entities[key]; !ok {
+			keys = append(keys, key)
+		}
+
+		entities[key] = append(entities[key], f)
+	}
+
+	for _, key := range keys {
+		written := entities[key]
+		entity := written[0].Entity
+
+		facts, err := dal.GetState(tx, domain, entity)
 
-	logrus.Debugf("transactor.Pipeline(%s): cache initialized", p.Domain)
+		if err != nil {
+			return err
+		}
+
+		for _, f := range written {
+			facts = replace(facts, f)
+		}
+
+		if _, err = dal.SetState(tx, domain, entity, facts); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// restate applies the facts of the segment to the state of their entities as
+// of the storage transaction. The cached state of a rebased segment does not
+// include the facts committed by the segments it was rebased onto.
+func (p *Pipeline) restate(tx storage.Tx) error {
+	seg := p.segment
+
+	for i := 0; i < seg.Blocks; i++ {
+		block, err := dal.GetBlock(tx, p.Domain, seg.UUID, i)
+
+		if err != nil {
+			return err
+		}
+
+		facts, err := origins.ReadAll(dal.NewBlockDecoder(block, p.Domain, seg.Transaction))
+
+		if err != nil {
+			return err
+		}
+
+		if err = applyState(tx, p.Domain, facts); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// writeState writes the dirty entities to the current-state index and sets
+// the head of the index to the passed segment ID.
+func (p *Pipeline) writeState(tx storage.Tx, head *uuid.UUID) error {
+	state, err := dal.GetLog(tx, p.Domain, stateLogName)
+
+	if err != nil {
+		return err
+	}
+
+	// The segment was rebased, so its state is applied to the state of the
+	// segment it now succeeds. If the index does not reflect that segment,
+	// it is left to be rebuilt by the next transaction.
+	if p.rebased {
+		if state == nil || !sameUUID(state.Head, p.segment.Next) {
+			logrus.Debugf("transactor.Pipeline(%s): state index is behind the log", p.Domain)
+			return nil
+		}
+
+		if err = p.restate(tx); err != nil {
+			return err
+		}
+
+		state.Head = head
+
+		_, err = dal.SetLog(tx, p.Domain, state)
+
+		return err
+	}
+
+	if state == nil {
+		state = &dal.Log{
+			Name:   stateLogName,
+			Domain: p.Domain,
+		}
+	} else if !p.rebuilt && !sameUUID(state.Head, p.segment.Base) {
+		return ErrCommitConflict
+	}
+
+	for _, entity := range p.dirty {
+		facts, err := p.load(tx, entity)
+
+		if err != nil {
+			return err
+		}
+
+		if _, err = dal.SetState(tx, p.Domain, entity, facts); err != nil {
+			return err
+		}
+	}
+
+	state.Head = head
+
+	_, err = dal.SetLog(tx, p.Domain, state)
 
 	return err
 }
@@ -107,6 +508,17 @@ func (p *Pipeline) Init(tx *Transaction) error {
 		log = &dal.Log{}
 	}
 
+	state, err := dal.GetLog(tx.Engine, p.Domain, stateLogName)
+
+	if err != nil {
+		return err
+	}
+
+	// The state index is missing or does not reflect the head of the log.
+	if log.Head != nil && (state == nil || !sameUUID(state.Head, log.Head)) {
+		p.rebuild = true
+	}
+
 	// Initialize new segment pointing to the head of the log.
 	p.segment = NewSegment(tx.Engine, p.Domain, tx.ID)
 	p.segment.Base = log.Head
@@ -114,66 +526,261 @@ func (p *Pipeline) Init(tx *Transaction) error {
 	p.segment.Time = tx.StartTime
 	p.engine = tx.Engine
 	p.dedupe = !tx.options.AllowDuplicates
+	p.written = &tx.written
+	p.maxBytes = tx.options.MaxBytes
+	p.cardinalities = tx.options.Cardinalities
+	p.cache = ctrie.New(nil)
+	p.dirty = make(map[string]*origins.Ident)
+	p.pending = make(map[string]origins.Facts)
+	p.empty = log.Head == nil
+	p.ones = make(map[string]bool)
+	p.preview = tx.options.Preview
+	p.prior = make(map[string]origins.Facts)
+	p.implied = make(map[*origins.Fact]struct{})
+
+	if f := tx.options.OnProgress; f != nil {
+		p.progress = func() {
+			f(tx.Progress())
+		}
+	}
+
+	// Facts are not deduped in bulk mode, so only domains without any
+	// facts can be loaded. The state of the entities is written when the
+	// pipeline is committed.
+	if tx.options.BulkLoad && !tx.options.Preview && !reserved(p.Domain) {
+		if log.Head != nil {
+			return ErrBulkExisting
+		}
+
+		p.bulk = newBulkWriter(p, tx)
+	}
+
+	return nil
+}
+
+// retractEntity writes a retraction for each currently asserted fact about the
+// entity. The cached facts are copied since writing updates them in place.
+func (p *Pipeline) retractEntity(fact *origins.Fact, facts origins.Facts) error {
+	for _, f := range append(origins.Facts(nil), facts...) {
+		if f.Operation != origins.Assertion {
+			continue
+		}
+
+		r := &origins.Fact{
+			Operation: origins.Retraction,
+			Domain:    fact.Domain,
+			Entity:    fact.Entity,
+			Attribute: f.Attribute,
+			Value:     f.Value,
+			Time:      fact.Time,
+		}
+
+		if err := p.write(r); err != nil {
+			return err
+		}
+	}
 
 	return nil
 }
 
 // Handle takes a fact and returns an error if the fact cannot be handled.
 func (p *Pipeline) Handle(fact *origins.Fact) error {
-	// Do not dedupe.
-	if !p.dedupe {
-		return p.segment.Write(fact)
+	if p.bulk != nil {
+		if fact.Attribute.Domain == origins.MacrosDomain {
+			return ErrBulkMacro
+		}
+
+		fact.Transaction = p.segment.Transaction
+		atomic.AddInt64(&p.nfacts, 1)
+
+		p.bulk.Write(fact)
+
+		return nil
 	}
 
-	// Initialize the cache.
-	if !p.initialized {
-		if err := p.initCache(); err != nil {
+	if p.rebuild && !p.rebuilt {
+		if err := p.rebuildState(); err != nil {
 			return err
 		}
 	}
 
-	// First transaction of the domain, write everything.
-	if p.cache == nil {
-		return p.segment.Write(fact)
-	}
-
 	var (
-		ok    bool
-		facts origins.Facts
-		value interface{}
+		err error
+		one bool
 	)
 
-	// Lookup the fact by name in the cache to get the facts.
-	if value, ok = p.cache.Lookup([]byte(fact.Entity.Name)); !ok {
-		return p.segment.Write(fact)
+	macro := fact.Attribute.Domain == origins.MacrosDomain && fact.Attribute.Name == origins.EntityMacro
+
+	if fact.Operation == origins.Assertion && !macro {
+		if one, err = p.one(fact.Attribute); err != nil {
+			return err
+		}
+	}
+
+	// The state of the entity is only needed to dedupe or retract facts.
+	if !p.dedupe && !macro && !one {
+		return p.write(fact)
 	}
 
-	// Type assert to facts.
-	facts = value.(origins.Facts)
+	facts, err := p.lookup(fact.Entity)
 
-	// Entity exists, check for an existing attribute.
+	if err != nil {
+		return err
+	}
+
+	// Retract the entity as a whole.
+	if macro {
+		return p.retractEntity(fact, facts)
+	}
+
+	// Check for an existing fact with the same attribute and value.
 	prev := origins.First(origins.NewBuffer(facts), func(f *origins.Fact) bool {
-		return f.Attribute.Is(fact.Attribute)
+		return f.Attribute.Is(fact.Attribute) && f.Value.Is(fact.Value)
 	})
 
-	// New attribute for entity.
-	if prev == nil {
-		return p.segment.Write(fact)
+	// Same operation as the most recent fact, nothing to write.
+	if p.dedupe && prev != nil && fact.Operation == prev.Operation {
+		return nil
+	}
+
+	// Retract the previously asserted values of the attribute. The cached
+	// facts are copied since writing updates them in place.
+	if one {
+		for _, f := range append(origins.Facts(nil), facts...) {
+			if f.Operation != origins.Assertion || !f.Attribute.Is(fact.Attribute) || f.Value.Is(fact.Value) {
+				continue
+			}
+
+			r := &origins.Fact{
+				Operation: origins.Retraction,
+				Domain:    fact.Domain,
+				Entity:    fact.Entity,
+				Attribute: fact.Attribute,
+				Value:     f.Value,
+				Time:      fact.Time,
+			}
+
+			if err = p.write(r); err != nil {
+				return err
+			}
+
+			if p.preview {
+				p.implied[r] = struct{}{}
+			}
+		}
+	}
+
+	return p.write(fact)
+}
+
+// Preview returns the facts written by the pipeline and the events they cause
+// relative to the state of the entities prior to the transaction. This is only
+// available if the transaction is run with the Preview option.
+func (p *Pipeline) Preview() (origins.Facts, []*view.Event, error) {
+	buf := origins.NewBuffer(nil)
+
+	// The prior state of the entities precedes the written facts so the
+	// events are derived relative to it.
+	for _, facts := range p.prior {
+		for _, f := range facts {
+			if f.Operation == origins.Assertion {
+				buf.Write(f)
+			}
+		}
+	}
+
+	// Implied retractions are excluded so replacing the value of an attribute
+	// with a cardinality of one is derived as a single change.
+	for _, f := range p.facts {
+		if _, ok := p.implied[f]; !ok {
+			buf.Write(f)
+		}
 	}
 
-	// Compare the values.
-	if fact.Value.Is(prev.Value) && fact.Operation == prev.Operation {
+	events, err := view.Timeline(buf, view.Ascending)
+
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// Only keep the events caused by this transaction.
+	var caused []*view.Event
+
+	for _, e := range events {
+		if e.After.Transaction == p.segment.Transaction {
+			caused = append(caused, e)
+		}
+	}
+
+	return p.facts, caused, nil
+}
+
+// Flush waits for the facts written in bulk to be flushed to storage.
+func (p *Pipeline) Flush() error {
+	if p.bulk == nil {
 		return nil
 	}
 
-	return p.segment.Write(fact)
+	return p.bulk.Close()
 }
 
 // Abort aborts the pipeline and deletes any data written to storage.
 func (p *Pipeline) Abort(tx storage.Tx) error {
+	// The pipeline failed to initialize.
+	if p.segment == nil {
+		return nil
+	}
+
 	return p.segment.Abort(tx)
 }
 
+// rebase moves the segment to succeed the passed head rather than its base.
+func (p *Pipeline) rebase(tx storage.Tx, head *uuid.UUID) error {
+	logrus.Debugf("pipeline: rebasing segment in %s onto %s", p.Domain, head)
+
+	p.rebased = true
+	p.segment.Next = head
+
+	_, err := dal.SetSegment(tx, p.Domain, &p.segment.Segment)
+
+	return err
+}
+
+// bound records the greatest transaction and latest time of the segment and
+// the segments it succeeds so reads of the log bounded below can stop early.
+func (p *Pipeline) bound(tx storage.Tx) error {
+	seg := &p.segment.Segment
+
+	seg.MaxTransaction = seg.Transaction
+	seg.MaxTime = seg.Time
+
+	if seg.Next != nil {
+		next, err := dal.GetSegment(tx, p.Domain, seg.Next)
+
+		if err != nil {
+			return err
+		}
+
+		// The bounds of the older segments are unknown.
+		if next == nil || next.MaxTransaction == 0 {
+			seg.MaxTransaction = 0
+			seg.MaxTime = time.Time{}
+		} else {
+			if next.MaxTransaction > seg.MaxTransaction {
+				seg.MaxTransaction = next.MaxTransaction
+			}
+
+			if next.MaxTime.After(seg.MaxTime) {
+				seg.MaxTime = next.MaxTime
+			}
+		}
+	}
+
+	_, err := dal.SetSegment(tx, p.Domain, seg)
+
+	return err
+}
+
 // Commit takes a storage transaction and writes any headers or indexes to make
 // the transacted facts visible. A storage transaction is passed in to enable
 // the writes to occur atomically which ensures consistency of the transacted
@@ -189,10 +796,16 @@ func (p *Pipeline) Commit(tx storage.Tx) error {
 		return err
 	}
 
-	// No new facts, remove the segment.
+	// No new facts, remove the segment. A rebuilt index is still written
+	// so it does not need to be rebuilt again.
 	if p.segment.Count == 0 {
 		logrus.Debugf("pipeline: no facts written to %s, removing segment", p.Domain)
 		p.segment.Abort(tx)
+
+		if p.rebuilt {
+			return p.writeState(tx, p.segment.Base)
+		}
+
 		return nil
 	}
 
@@ -205,9 +818,14 @@ func (p *Pipeline) Commit(tx storage.Tx) error {
 
 	// Existing commit log, check if the head is the same.
 	if log != nil {
-		// TODO: determine path to handle conflicts.
-		if log.Head != nil && !uuid.Equal(*log.Head, *p.segment.Base) {
-			return ErrCommitConflict
+		if !sameUUID(log.Head, p.segment.Base) {
+			if _, ok := rebaseDomains[p.Domain]; !ok {
+				return ErrCommitConflict
+			}
+
+			if err = p.rebase(tx, log.Head); err != nil {
+				return err
+			}
 		}
 	} else {
 		log = &dal.Log{
@@ -216,9 +834,30 @@ func (p *Pipeline) Commit(tx storage.Tx) error {
 		}
 	}
 
+	if err = p.bound(tx); err != nil {
+		return err
+	}
+
 	log.Head = p.segment.UUID
 
-	_, err = dal.SetLog(tx, p.Domain, log)
+	if _, err = dal.SetLog(tx, p.Domain, log); err != nil {
+		return err
+	}
 
-	return err
+	// Facts written in bulk are indexed from the flushed blocks.
+	if p.bulk != nil {
+		if err = p.bulk.commit(tx); err != nil {
+			return err
+		}
+
+		err = setIndexed(tx, p.Domain, p.segment.UUID)
+	} else {
+		err = indexLog(tx, p.Domain)
+	}
+
+	if err != nil {
+		return err
+	}
+
+	return p.writeState(tx, p.segment.UUID)
 }
@@ -0,0 +1,377 @@
+package transactor
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/chop-dbhi/origins"
+	"github.com/chop-dbhi/origins/storage"
+)
+
+// Number of completed jobs a queue keeps for reporting.
+var queueHistory = 100
+
+// Default maximum number of facts in a job submitted to a queue.
+var queueMaxFacts = 1000000
+
+// JobState is the state of a queued job.
+type JobState string
+
+const (
+	JobQueued    JobState = "queued"
+	JobRunning   JobState = "running"
+	JobCommitted JobState = "committed"
+	JobFailed    JobState = "failed"
+)
+
+// Job is a stream of facts submitted to a queue to be transacted.
+type Job struct {
+	ID      uint64
+	State   JobState
+	Domains []string
+	Count   int
+
+	Submitted time.Time
+	Started   time.Time
+	Finished  time.Time
+
+	// Info of the transaction once the job is committed.
+	Info *Info
+
+	// Error that caused the job to fail.
+	Error string
+
+	options Options
+	facts   origins.Facts
+	done    chan struct{}
+}
+
+// QueueStatus reports the jobs in a queue.
+type QueueStatus struct {
+	Queued   []*Job
+	Running  []*Job
+	Finished []*Job
+}
+
+// Queue transacts submitted jobs. Jobs that transact to the same domain are
+// committed one at a time in the order they were submitted while jobs that
+// transact to different domains run in parallel. This avoids the commit
+// conflicts that occur when transactions to the same domain overlap.
+type Queue struct {
+	Engine storage.Engine
+
+	// Maximum number of facts in a submitted job. The facts are held in
+	// memory until the job runs, so this applies even if the transaction
+	// options do not limit the number of facts. A zero value means no limit.
+	MaxFacts int
+
+	mu sync.Mutex
+
+	// Sequence of job IDs.
+	seq uint64
+
+	// Jobs in the order they were submitted that have not been started.
+	pending []*Job
+
+	// Domains locked by a running job.
+	locked map[string]*Job
+
+	// All jobs that are being tracked keyed by ID and the completed jobs
+	// in the order they finished.
+	jobs     map[uint64]*Job
+	finished []*Job
+}
+
+// jobDomains returns the domains the facts are transacted to. The fact domain
+// is used prior to macro expansion, since the domain macro writes facts about
+// the domain itself.
+func jobDomains(facts origins.Facts, options Options) ([]string, error) {
+	set := make(map[string]struct{})
+
+	for _, f := range facts {
+		d := f.Domain
+
+		if d == "" {
+			if options.DefaultDomain == "" {
+				return nil, ErrNoDomain
+			}
+
+			d = options.DefaultDomain
+		}
+
+		set[d] = struct{}{}
+	}
+
+	domains := make([]string, 0, len(set))
+
+	for d := range set {
+		domains = append(domains, d)
+	}
+
+	sort.Strings(domains)
+
+	return domains, nil
+}
+
+// readJob reads the facts from the iterator. A LimitError is returned as soon
+// as the facts exceed the maximum.
+func readJob(iter origins.Iterator, max int) (origins.Facts, error) {
+	var facts origins.Facts
+
+	for f := iter.Next(); f != nil; f = iter.Next() {
+		if max > 0 && len(facts) == max {
+			return nil, &LimitError{
+				Limit: LimitFacts,
+				Max:   int64(max),
+			}
+		}
+
+		facts = append(facts, f)
+	}
+
+	if err := iter.Err(); err != nil {
+		return nil, err
+	}
+
+	return facts, nil
+}
+
+// Submit reads the facts from the iterator and queues them to be transacted
+// with the options. The facts are read in full before the job is queued, up
+// to the lower of the facts limits of the queue and the options.
+func (q *Queue) Submit(iter origins.Iterator, options Options) (*Job, error) {
+	max := options.MaxFacts
+
+	if q.MaxFacts > 0 && (max == 0 || q.MaxFacts < max) {
+		max = q.MaxFacts
+	}
+
+	facts, err := readJob(iter, max)
+
+	if err != nil {
+		return nil, err
+	}
+
+	domains, err := jobDomains(facts, options)
+
+	if err != nil {
+		return nil, err
+	}
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	q.seq++
+
+	job := &Job{
+		ID:        q.seq,
+		State:     JobQueued,
+		Domains:   domains,
+		Count:     len(facts),
+		Submitted: time.Now().UTC(),
+		options:   options,
+		facts:     facts,
+		done:      make(chan struct{}),
+	}
+
+	logrus.Debugf("transactor.Queue: job %d submitted for %v", job.ID, domains)
+
+	q.jobs[job.ID] = job
+	q.pending = append(q.pending, job)
+
+	q.schedule()
+
+	return job, nil
+}
+
+// schedule starts the pending jobs whose domains are not locked. A job is
+// not started ahead of an earlier pending job for the same domain so the
+// order of submission is preserved. The lock must be held by the caller.
+func (q *Queue) schedule() {
+	var (
+		pending []*Job
+		blocked = make(map[string]struct{})
+	)
+
+	for _, job := range q.pending {
+		ready := true
+
+		for _, d := range job.Domains {
+			if _, ok := q.locked[d]; ok {
+				ready = false
+			} else if _, ok := blocked[d]; ok {
+				ready = false
+			}
+		}
+
+		if !ready {
+			for _, d := range job.Domains {
+				blocked[d] = struct{}{}
+			}
+
+			pending = append(pending, job)
+			continue
+		}
+
+		for _, d := range job.Domains {
+			q.locked[d] = job
+		}
+
+		job.State = JobRunning
+		job.Started = time.Now().UTC()
+
+		go q.run(job)
+	}
+
+	q.pending = pending
+}
+
+// run transacts the facts of the job.
+func (q *Queue) run(job *Job) {
+	logrus.Debugf("transactor.Queue: job %d started", job.ID)
+
+	info, err := q.transact(job)
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	job.Finished = time.Now().UTC()
+	job.Info = info
+	job.facts = nil
+
+	if err != nil {
+		logrus.Errorf("transactor.Queue: job %d failed: %s", job.ID, err)
+		job.State = JobFailed
+		job.Error = err.Error()
+	} else {
+		logrus.Debugf("transactor.Queue: job %d committed", job.ID)
+		job.State = JobCommitted
+	}
+
+	for _, d := range job.Domains {
+		delete(q.locked, d)
+	}
+
+	q.finished = append(q.finished, job)
+
+	// Stop tracking the oldest jobs.
+	if len(q.finished) > queueHistory {
+		delete(q.jobs, q.finished[0].ID)
+		q.finished = q.finished[1:]
+	}
+
+	close(job.done)
+
+	q.schedule()
+}
+
+func (q *Queue) transact(job *Job) (*Info, error) {
+	tx, err := New(q.Engine, job.options)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err = origins.Copy(origins.NewBuffer(job.facts), tx); err != nil {
+		tx.Cancel()
+		return nil, err
+	}
+
+	if err = tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	if tx.CommitError != nil {
+		return nil, tx.CommitError
+	}
+
+	return tx.Info(), nil
+}
+
+// Wait blocks until the job is finished.
+func (q *Queue) Wait(job *Job) {
+	<-job.done
+}
+
+// Job returns a snapshot of the job with the ID or nil if the job is not
+// being tracked.
+func (q *Queue) Job(id uint64) *Job {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	job, ok := q.jobs[id]
+
+	if !ok {
+		return nil
+	}
+
+	c := *job
+
+	return &c
+}
+
+// Status returns a snapshot of the queued, running and recently finished jobs.
+func (q *Queue) Status() *QueueStatus {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	copyJob := func(job *Job) *Job {
+		c := *job
+		return &c
+	}
+
+	s := QueueStatus{
+		Queued:   make([]*Job, 0, len(q.pending)),
+		Running:  []*Job{},
+		Finished: make([]*Job, 0, len(q.finished)),
+	}
+
+	for _, job := range q.pending {
+		s.Queued = append(s.Queued, copyJob(job))
+	}
+
+	seen := make(map[uint64]struct{})
+
+	for _, job := range q.locked {
+		if _, ok := seen[job.ID]; ok {
+			continue
+		}
+
+		seen[job.ID] = struct{}{}
+		s.Running = append(s.Running, copyJob(job))
+	}
+
+	sort.Sort(jobsByID(s.Running))
+
+	for _, job := range q.finished {
+		s.Finished = append(s.Finished, copyJob(job))
+	}
+
+	return &s
+}
+
+type jobsByID []*Job
+
+func (j jobsByID) Len() int {
+	return len(j)
+}
+
+func (j jobsByID) Swap(a, b int) {
+	j[a], j[b] = j[b], j[a]
+}
+
+func (j jobsByID) Less(a, b int) bool {
+	return j[a].ID < j[b].ID
+}
+
+// NewQueue initializes a queue that transacts jobs to the storage engine.
+func NewQueue(engine storage.Engine) *Queue {
+	return &Queue{
+		Engine:   engine,
+		MaxFacts: queueMaxFacts,
+		locked:   make(map[string]*Job),
+		jobs:     make(map[uint64]*Job),
+	}
+}
@@ -0,0 +1,151 @@
+package transactor
+
+import (
+	"bytes"
+	"fmt"
+	"sync"
+	"testing"
+
+	"github.com/chop-dbhi/origins"
+	"github.com/stretchr/testify/assert"
+)
+
+func submitCSV(t *testing.T, q *Queue, domain, data string) *Job {
+	options := DefaultOptions
+	options.DefaultDomain = domain
+
+	job, err := q.Submit(origins.NewCSVReader(bytes.NewBufferString(data)), options)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return job
+}
+
+func TestQueue(t *testing.T) {
+	engine, _ := origins.Init("mem", nil)
+
+	q := NewQueue(engine)
+
+	var (
+		wg   sync.WaitGroup
+		jobs []*Job
+		mu   sync.Mutex
+	)
+
+	// Concurrent submissions to the same and different domains.
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+
+		go func(i int) {
+			defer wg.Done()
+
+			job := submitCSV(t, q, fmt.Sprintf("test%d", i%3), fmt.Sprintf(`
+entity,attribute,value
+bob,count,%d
+`, i))
+
+			mu.Lock()
+			jobs = append(jobs, job)
+			mu.Unlock()
+		}(i)
+	}
+
+	wg.Wait()
+
+	for _, job := range jobs {
+		q.Wait(job)
+
+		job = q.Job(job.ID)
+
+		assert.Equal(t, JobCommitted, job.State, job.Error)
+		assert.Equal(t, 1, len(txFacts(t, engine, job.Domains[0], job.Info.ID)))
+	}
+
+	// Transaction records from parallel commits are rebased.
+	for _, job := range jobs {
+		assert.NotEqual(t, 0, len(txFacts(t, engine, origins.TransactionsDomain, job.Info.ID)))
+	}
+
+	status := q.Status()
+
+	assert.Equal(t, 0, len(status.Queued))
+	assert.Equal(t, 0, len(status.Running))
+	assert.Equal(t, 10, len(status.Finished))
+}
+
+func TestQueueNoDomain(t *testing.T) {
+	engine, _ := origins.Init("mem", nil)
+
+	q := NewQueue(engine)
+
+	_, err := q.Submit(origins.NewCSVReader(bytes.NewBufferString(`
+entity,attribute,value
+bob,city,Norristown
+`)), DefaultOptions)
+
+	assert.Equal(t, ErrNoDomain, err)
+}
+
+func TestQueueSchedule(t *testing.T) {
+	engine, _ := origins.Init("mem", nil)
+
+	q := NewQueue(engine)
+
+	// Hold the lock so the jobs are not started while being scheduled.
+	q.locked["a"] = &Job{ID: 100}
+
+	j1 := submitCSV(t, q, "a", "entity,attribute,value\nbob,city,Norristown\n")
+	j2 := submitCSV(t, q, "b", "domain,entity,attribute,value\na,bob,city,Bethlehem\nb,bob,city,Bethlehem\n")
+	j3 := submitCSV(t, q, "c", "entity,attribute,value\nbob,city,Allentown\n")
+
+	q.Wait(j3)
+
+	// j2 waits behind j1 since they share a domain.
+	status := q.Status()
+
+	assert.Equal(t, 2, len(status.Queued))
+	assert.Equal(t, j1.ID, status.Queued[0].ID)
+	assert.Equal(t, j2.ID, status.Queued[1].ID)
+
+	q.mu.Lock()
+	delete(q.locked, "a")
+	q.schedule()
+	q.mu.Unlock()
+
+	q.Wait(j1)
+	q.Wait(j2)
+
+	assert.True(t, q.Job(j1.ID).Finished.Before(q.Job(j2.ID).Started) || q.Job(j1.ID).Finished.Equal(q.Job(j2.ID).Started))
+}
+
+func TestQueueMaxFacts(t *testing.T) {
+	engine, _ := origins.Init("mem", nil)
+
+	q := NewQueue(engine)
+	q.MaxFacts = 2
+
+	data := `
+entity,attribute,value
+bob,city,Norristown
+bob,likes,soccer
+bob,age,30
+`
+
+	options := DefaultOptions
+	options.DefaultDomain = "test"
+
+	_, err := q.Submit(origins.NewCSVReader(bytes.NewBufferString(data)), options)
+
+	assert.Equal(t, &LimitError{Limit: LimitFacts, Max: 2}, err)
+
+	// The lower limit of the options applies.
+	options.MaxFacts = 1
+
+	_, err = q.Submit(origins.NewCSVReader(bytes.NewBufferString(data)), options)
+
+	assert.Equal(t, &LimitError{Limit: LimitFacts, Max: 1}, err)
+
+	assert.Equal(t, 0, len(q.Status().Queued))
+}
@@ -0,0 +1,115 @@
+package transactor
+
+import (
+	"github.com/chop-dbhi/origins"
+	"github.com/chop-dbhi/origins/dal"
+	"github.com/chop-dbhi/origins/storage"
+)
+
+// ReadOnlyAttr is the attribute of a domain in the domains domain that flags
+// whether the domain is read-only. The attribute is matched by name so it may
+// also be set using the domain macro.
+const ReadOnlyAttr = "readOnly"
+
+// domainEntities returns the entities facts about the domain are stored under.
+// Facts written directly to the domains domain are qualified by it while the
+// domain macro leaves the entity unqualified.
+func domainEntities(domain string) []*origins.Ident {
+	return []*origins.Ident{
+		{
+			Domain: origins.DomainsDomain,
+			Name:   domain,
+		},
+		{
+			Name: domain,
+		},
+	}
+}
+
+// ReadOnly returns true if the domain is flagged as read-only. The most
+// recent fact about the flag determines the state. The current-state index
+// of the domains domain is used since every transaction writes to it.
+func ReadOnly(engine storage.Engine, domain string) (bool, error) {
+	return readOnly(engine, domain)
+}
+
+// readOnly returns true if the domain is flagged as read-only as of the
+// storage transaction.
+func readOnly(tx storage.Tx, domain string) (bool, error) {
+	var latest *origins.Fact
+
+	for _, entity := range domainEntities(domain) {
+		facts, err := dal.GetState(tx, origins.DomainsDomain, entity)
+
+		if err != nil {
+			return false, err
+		}
+
+		for _, f := range facts {
+			if f.Attribute.Name != ReadOnlyAttr {
+				continue
+			}
+
+			if latest == nil || f.Transaction > latest.Transaction {
+				latest = f
+			}
+		}
+	}
+
+	if latest == nil {
+		return false, nil
+	}
+
+	return latest.Operation == origins.Assertion && latest.Value.Name == "true", nil
+}
+
+// SetReadOnly flags the domain as read-only or writable. Transactions that
+// write to a read-only domain fail with ErrReadOnlyDomain.
+func SetReadOnly(engine storage.Engine, domain string, readOnly bool) (*Transaction, error) {
+	if domain == "" {
+		return nil, ErrNoDomain
+	}
+
+	options := DefaultOptions
+	options.Privileged = true
+
+	tx, err := New(engine, options)
+
+	if err != nil {
+		return nil, err
+	}
+
+	value := "false"
+
+	if readOnly {
+		value = "true"
+	}
+
+	err = tx.Write(&origins.Fact{
+		Domain: origins.DomainsDomain,
+		Entity: &origins.Ident{
+			Name: domain,
+		},
+		Attribute: &origins.Ident{
+			Name: ReadOnlyAttr,
+		},
+		Value: &origins.Ident{
+			Name: value,
+		},
+	})
+
+	if err != nil {
+		tx.Cancel()
+		return nil, err
+	}
+
+	if err = tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	if tx.CommitError != nil {
+		return nil, tx.CommitError
+	}
+
+	return tx, nil
+}
@@ -0,0 +1,156 @@
+package transactor
+
+import (
+	"fmt"
+
+	"github.com/chop-dbhi/origins"
+	"github.com/chop-dbhi/origins/storage"
+	"github.com/chop-dbhi/origins/view"
+)
+
+// revertedDomains returns the domains the transaction was pinged in. The
+// domains and transactions domains are excluded since they record the
+// history of the transactions themselves.
+func revertedDomains(engine storage.Engine, id uint64) ([]string, error) {
+	log, err := view.OpenLog(engine, origins.DomainsDomain, commitLogName)
+
+	if err == view.ErrDoesNotExist {
+		return nil, ErrUnknownTransaction
+	} else if err != nil {
+		return nil, err
+	}
+
+	var domains []string
+
+	err = origins.Map(log.Now(), func(f *origins.Fact) error {
+		if f.Transaction != id || f.Attribute.Name != "ping" {
+			return nil
+		}
+
+		switch f.Entity.Name {
+		case origins.DomainsDomain, origins.TransactionsDomain:
+		default:
+			domains = append(domains, f.Entity.Name)
+		}
+
+		return nil
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	if len(domains) == 0 {
+		return nil, ErrUnknownTransaction
+	}
+
+	return domains, nil
+}
+
+// inverse returns the facts that undo the facts written by the transaction
+// in the domain. Retractions are ordered before assertions.
+func inverse(engine storage.Engine, domain string, id uint64) (origins.Facts, error) {
+	log, err := view.OpenLog(engine, domain, commitLogName)
+
+	if err != nil {
+		return nil, err
+	}
+
+	var retracts, asserts origins.Facts
+
+	err = origins.Map(log.Now(), func(f *origins.Fact) error {
+		if f.Transaction != id {
+			return nil
+		}
+
+		i := &origins.Fact{
+			Domain:    f.Domain,
+			Entity:    f.Entity,
+			Attribute: f.Attribute,
+			Value:     f.Value,
+			Time:      f.Time,
+		}
+
+		if f.Operation == origins.Assertion {
+			i.Operation = origins.Retraction
+			retracts = append(retracts, i)
+		} else {
+			i.Operation = origins.Assertion
+			asserts = append(asserts, i)
+		}
+
+		return nil
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	return append(retracts, asserts...), nil
+}
+
+// Revert transacts the inverse of the facts written by the transaction with
+// the ID. Asserted facts are retracted and retracted facts, including the
+// values implicitly retracted for attributes with a cardinality of one, are
+// asserted again. The reverting transaction is linked to the original by a
+// reverts fact in the transactions domain. The committed transaction is
+// returned.
+func Revert(engine storage.Engine, id uint64) (*Transaction, error) {
+	domains, err := revertedDomains(engine, id)
+
+	if err != nil {
+		return nil, err
+	}
+
+	var facts origins.Facts
+
+	for _, d := range domains {
+		f, err := inverse(engine, d, id)
+
+		if err != nil {
+			return nil, err
+		}
+
+		facts = append(facts, f...)
+	}
+
+	// The reverts fact is written to the transactions domain.
+	options := DefaultOptions
+	options.Privileged = true
+
+	tx, err := New(engine, options)
+
+	if err != nil {
+		return nil, err
+	}
+
+	facts = append(facts, &origins.Fact{
+		Domain: origins.TransactionsDomain,
+		Entity: &origins.Ident{
+			Domain: origins.MacrosDomain,
+			Name:   "tx",
+		},
+		Attribute: &origins.Ident{
+			Name: "reverts",
+		},
+		Value: &origins.Ident{
+			Domain: origins.TransactionsDomain,
+			Name:   fmt.Sprint(id),
+		},
+	})
+
+	if _, err = origins.Copy(origins.NewBuffer(facts), tx); err != nil {
+		tx.Cancel()
+		return nil, err
+	}
+
+	if err = tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	if tx.CommitError != nil {
+		return nil, tx.CommitError
+	}
+
+	return tx, nil
+}
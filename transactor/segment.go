@@ -86,6 +86,11 @@ func (s *Segment) Write(f *origins.Fact) error {
 	return nil
 }
 
+// Size returns the number of bytes of the written blocks and the current block.
+func (s *Segment) Size() int {
+	return s.Bytes + len(s.block.Bytes())
+}
+
 // Commit writes the last partial block.
 func (s *Segment) Commit(tx storage.Tx) error {
 	s.committed = true
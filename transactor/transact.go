@@ -1,15 +1,24 @@
 package transactor
 
 import (
+	"encoding/json"
 	"errors"
 	"fmt"
+	"io"
+	"sort"
+	"strings"
 	"sync"
+	"sync/atomic"
+	"text/template"
 	"time"
 
 	"github.com/Sirupsen/logrus"
 	"github.com/chop-dbhi/origins"
 	"github.com/chop-dbhi/origins/chrono"
+	"github.com/chop-dbhi/origins/schema"
 	"github.com/chop-dbhi/origins/storage"
+	"github.com/chop-dbhi/origins/view"
+	"github.com/satori/go.uuid"
 )
 
 var (
@@ -18,9 +27,22 @@ var (
 	ErrCommitConflict = errors.New("transactor: commit conflict")
 	ErrReceiveTimeout = errors.New("transactor: receive timeout")
 	ErrNoDomain       = errors.New("transactor: no fact domain")
+	ErrNoEntity       = errors.New("transactor: no entity")
 	ErrCouldNotRoute  = errors.New("transactor: could not route")
+	ErrNoPreview      = errors.New("transactor: not a preview")
+	ErrDuplicateKey   = errors.New("transactor: idempotency key already committed")
+
+	ErrUnknownTransaction = errors.New("transactor: unknown transaction")
+	ErrBulkMacro          = errors.New("transactor: attribute macros are not supported in bulk mode")
+	ErrBulkExisting       = errors.New("transactor: bulk mode requires a domain without commits")
+	ErrReservedDomain     = errors.New("transactor: domain is reserved")
+	ErrReadOnlyDomain     = errors.New("transactor: domain is read-only")
+	ErrExcisionChanged    = errors.New("transactor: excised facts changed before commit")
 )
 
+// Storage part committed idempotency keys are stored in.
+const idempotencyPart = "origins.idempotency"
+
 // txid increments a global transaction ID.
 func txid(tx storage.Tx) (uint64, error) {
 	return tx.Incr("origins", "tx")
@@ -46,6 +68,153 @@ type Options struct {
 
 	// If true, duplicates will facts will be written to storage.
 	AllowDuplicates bool
+
+	// Cardinalities of attributes keyed by their fully qualified identity,
+	// such as "people/email". These take precedence over the cardinality
+	// declared in the domain schema. When a new value is asserted for an
+	// attribute with a cardinality of one, the previous value is retracted.
+	Cardinalities map[string]schema.Cardinality
+
+	// If true, temporary IDs are resolved to the next number of a sequence
+	// maintained per domain rather than a random UUID.
+	TempidSequence bool
+
+	// Metadata about the transaction, such as the author, reason or source,
+	// keyed by attribute. Each pair is written as a fact about the transaction
+	// entity in the transactions domain.
+	Meta map[string]string
+
+	// If true, the transaction is processed as usual but aborted rather than
+	// committed. The facts that would have been written and the events they
+	// would cause are available by calling Preview.
+	Preview bool
+
+	// Client-supplied key that uniquely identifies the transaction. If a
+	// transaction with the same key has already been committed, the facts are
+	// discarded and the info of the original transaction is returned.
+	IdempotencyKey string
+
+	// Limits of the transaction. If a limit is exceeded, the transaction is
+	// aborted with a LimitError. A zero value means no limit.
+	MaxFacts    int
+	MaxBytes    int
+	MaxDomains  int
+	MaxDuration time.Duration
+
+	// If true, facts are encoded by several workers per domain and written
+	// in batches. Duplicates are not removed, the cardinality of attributes
+	// is not enforced and the order of facts within the transaction is not
+	// preserved. Domains that have already been committed to cannot be
+	// loaded in bulk.
+	BulkLoad bool
+
+	// Number of encoder workers per domain in bulk mode. Defaults to the
+	// number of CPUs.
+	BulkWorkers int
+
+	// If defined, called with the progress of the transaction each time a
+	// pipeline flushes a block to storage. It may be called concurrently by
+	// the pipelines of the transaction.
+	OnProgress func(*Progress)
+
+	// If greater than zero, OnProgress is also called at this interval while
+	// the transaction is running, so progress is reported while no blocks
+	// are flushed, such as when most facts are duplicates.
+	ProgressInterval time.Duration
+
+	// If true, facts may be written to the reserved origins.* domains and the
+	// read-only flag of domains may be changed. Facts about the transaction
+	// itself and facts expanded by the domain and tx macros are always
+	// permitted.
+	Privileged bool
+}
+
+// reserved returns true if the domain is reserved for use by origins.
+func reserved(domain string) bool {
+	return strings.HasPrefix(domain, "origins.")
+}
+
+// Limit names a limit of a transaction.
+type Limit string
+
+const (
+	LimitFacts    Limit = "facts"
+	LimitBytes    Limit = "bytes"
+	LimitDomains  Limit = "domains"
+	LimitDuration Limit = "duration"
+)
+
+// LimitError is the error a transaction is aborted with when it exceeds
+// one of its limits.
+type LimitError struct {
+	Limit Limit
+	Max   int64
+}
+
+func (e *LimitError) Error() string {
+	if e.Limit == LimitDuration {
+		return fmt.Sprintf("transactor: %s limit of %s exceeded", e.Limit, time.Duration(e.Max))
+	}
+
+	return fmt.Sprintf("transactor: %s limit of %d exceeded", e.Limit, e.Max)
+}
+
+// Attributes of the transaction entity that are written by the transactor
+// and cannot be set as metadata.
+var reservedMeta = map[string]struct{}{
+	"startTime": struct{}{},
+	"endTime":   struct{}{},
+	"error":     struct{}{},
+}
+
+// metaAttr returns the attribute of the transaction entity the metadata key
+// is written as.
+func metaAttr(key string) (*origins.Ident, error) {
+	attr, err := origins.ParseIdent(key)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if attr.Name == "" {
+		return nil, fmt.Errorf("transactor: invalid meta key %q", key)
+	}
+
+	// Attributes without a domain default to the transactions domain.
+	if attr.Domain == "" || attr.Domain == origins.TransactionsDomain {
+		if _, ok := reservedMeta[attr.Name]; ok {
+			return nil, fmt.Errorf("transactor: meta key %s is reserved", key)
+		}
+	}
+
+	return attr, nil
+}
+
+// ParseMeta parses key=value pairs into a map of transaction metadata.
+func ParseMeta(pairs []string) (map[string]string, error) {
+	meta := make(map[string]string, len(pairs))
+
+	for _, p := range pairs {
+		toks := strings.SplitN(p, "=", 2)
+
+		if len(toks) != 2 {
+			return nil, fmt.Errorf("transactor: invalid meta %s, expected key=value", p)
+		}
+
+		key := strings.TrimSpace(toks[0])
+
+		if key == "" {
+			return nil, fmt.Errorf("transactor: invalid meta %s, expected key=value", p)
+		}
+
+		if _, err := metaAttr(key); err != nil {
+			return nil, err
+		}
+
+		meta[key] = strings.TrimSpace(toks[1])
+	}
+
+	return meta, nil
 }
 
 // DefaultOptions hold the default options for a transaction.
@@ -79,6 +248,12 @@ type Transaction struct {
 	// transaction stream has been closed.
 	done chan struct{}
 
+	// Closed when the transaction stops receiving facts. Errors that occur
+	// after this are kept until the transaction completes.
+	stopped chan struct{}
+	mu      sync.Mutex
+	lateErr error
+
 	// Shared error channel for all goroutines to communicate when an
 	// error occurs.
 	errch chan error
@@ -95,6 +270,29 @@ type Transaction struct {
 
 	// Entity ident of transaction.
 	entity *origins.Ident
+
+	// Template macros declared in the macros domain.
+	templates map[string]*template.Template
+
+	// Temporary IDs to the identities they resolved to.
+	tempids map[string]*origins.Ident
+
+	// Info of the committed transaction with the same idempotency key.
+	replayed *Info
+
+	// If defined, called in the storage transaction the pipelines are
+	// committed in before they are.
+	prepare func(storage.Tx) error
+
+	// Domains that have been checked for the read-only flag.
+	readOnly map[string]bool
+
+	// Number of facts and domains received, facts routed to pipelines and
+	// bytes written across pipelines.
+	received int64
+	routed   int64
+	ndomains int
+	written  int64
 }
 
 // Info holds information about a transaction.
@@ -106,11 +304,207 @@ type Info struct {
 	Domains   []*Stats
 	Bytes     int
 	Count     int
+	Tempids   map[string]*origins.Ident
+
+	// True if the transaction was not processed since a transaction with
+	// the same idempotency key was already committed.
+	Replayed bool
+}
+
+// getIdempotent returns the info of the committed transaction with the
+// idempotency key or nil if one does not exist.
+func getIdempotent(tx storage.Tx, key string) (*Info, error) {
+	b, err := tx.Get(idempotencyPart, key)
+
+	if err != nil || b == nil {
+		return nil, err
+	}
+
+	var info Info
+
+	if err = json.Unmarshal(b, &info); err != nil {
+		return nil, err
+	}
+
+	return &info, nil
+}
+
+// setIdempotent stores the info of the committed transaction for the
+// idempotency key.
+func setIdempotent(tx storage.Tx, key string, info *Info) error {
+	b, err := json.Marshal(info)
+
+	if err != nil {
+		return err
+	}
+
+	return tx.Set(idempotencyPart, key, b)
+}
+
+// Preview holds the facts a transaction would write and the events they would
+// cause relative to the current state.
+type Preview struct {
+	Facts  origins.Facts
+	Events []*view.Event
+}
+
+// WriteCSV writes the facts followed by the events in a CSV format. The two
+// sections are separated by an empty line.
+func (pv *Preview) WriteCSV(w io.Writer) error {
+	fw := origins.NewCSVWriter(w)
+
+	for _, f := range pv.Facts {
+		if err := fw.Write(f); err != nil {
+			return err
+		}
+	}
+
+	if err := fw.Flush(); err != nil {
+		return err
+	}
+
+	if _, err := io.WriteString(w, "\n"); err != nil {
+		return err
+	}
+
+	ew := view.NewEventCSVWriter(w)
+
+	for _, e := range pv.Events {
+		if err := ew.Write(e); err != nil {
+			return err
+		}
+	}
+
+	return ew.Flush()
+}
+
+// Preview returns the facts and events of a transaction run with the Preview
+// option. It must be called after the transaction is complete.
+func (tx *Transaction) Preview() (*Preview, error) {
+	if !tx.options.Preview {
+		return nil, ErrNoPreview
+	}
+
+	if tx.Error != nil {
+		return nil, tx.Error
+	}
+
+	pv := Preview{
+		Facts: origins.Facts{},
+	}
+
+	for _, d := range tx.allDomains() {
+		facts, events, err := tx.pipes[d].Preview()
+
+		if err != nil {
+			return nil, err
+		}
+
+		pv.Facts = append(pv.Facts, facts...)
+		pv.Events = append(pv.Events, events...)
+	}
+
+	return &pv, nil
+}
+
+// allDomains returns the transacted domains followed by the domains that
+// were written to by the transaction itself.
+func (tx *Transaction) allDomains() []string {
+	var (
+		domains = append([]string(nil), tx.domains...)
+		seen    = make(map[string]struct{}, len(tx.pipes))
+	)
+
+	for _, d := range domains {
+		seen[d] = struct{}{}
+	}
+
+	var rest []string
+
+	for d := range tx.pipes {
+		if _, ok := seen[d]; !ok {
+			rest = append(rest, d)
+		}
+	}
+
+	sort.Strings(rest)
+
+	return append(domains, rest...)
+}
+
+// Progress reports the progress of a running transaction.
+type Progress struct {
+	// Number of facts received by the transaction.
+	Received int
+
+	// Number of received facts that were routed to the pipelines of their
+	// domains.
+	Routed int
+
+	// Number of facts written across domains after duplicates are removed
+	// and implied retractions are added.
+	Written int
+
+	// Number of blocks flushed to storage across domains.
+	Blocks int
+
+	Domains []*DomainProgress
+}
+
+// DomainProgress reports the progress of a transaction in a domain.
+type DomainProgress struct {
+	Domain  string
+	Written int
+	Blocks  int
+}
+
+func (p *Progress) String() string {
+	doms := make([]string, len(p.Domains))
+
+	for i, d := range p.Domains {
+		doms[i] = fmt.Sprintf("%s: %d/%d", d.Domain, d.Written, d.Blocks)
+	}
+
+	return fmt.Sprintf("%d received, %d routed, %d written, %d blocks flushed (%s)", p.Received, p.Routed, p.Written, p.Blocks, strings.Join(doms, ", "))
+}
+
+// Progress returns a snapshot of the progress of the transaction. It is safe
+// to call while the transaction is running.
+func (tx *Transaction) Progress() *Progress {
+	tx.mu.Lock()
+	domains := tx.allDomains()
+	pipes := make([]*Pipeline, len(domains))
+
+	for i, d := range domains {
+		pipes[i] = tx.pipes[d]
+	}
+
+	tx.mu.Unlock()
+
+	p := Progress{
+		Received: int(atomic.LoadInt64(&tx.received)),
+		Routed:   int(atomic.LoadInt64(&tx.routed)),
+		Domains:  make([]*DomainProgress, len(pipes)),
+	}
+
+	for i, pipe := range pipes {
+		d := pipe.Progress()
+
+		p.Written += d.Written
+		p.Blocks += d.Blocks
+		p.Domains[i] = d
+	}
+
+	return &p
 }
 
 // Stats returns the stats of the transaction which aggregates
 // them from the pipelines.
 func (tx *Transaction) Info() *Info {
+	if tx.replayed != nil {
+		return tx.replayed
+	}
+
 	var (
 		bytes int
 		count int
@@ -138,6 +532,7 @@ func (tx *Transaction) Info() *Info {
 		Domains:   stats,
 		Bytes:     bytes,
 		Count:     count,
+		Tempids:   tx.tempids,
 	}
 }
 
@@ -177,47 +572,126 @@ func (tx *Transaction) macro(fact *origins.Fact) error {
 
 	// Entity-based macro.
 	if fact.Entity.Domain == origins.MacrosDomain {
-		switch fact.Entity.Name {
-
-		// Facts about the domain.
-		case "domain":
-			fact.Entity.Name = fact.Domain
-			fact.Domain = origins.DomainsDomain
-			fact.Entity.Domain = ""
+		if err := tx.expand(entityMacros, "entity", fact, fact.Entity); err != nil {
+			return err
+		}
+	}
 
-		// Facts about the transaction.
-		case "tx":
-			fact.Domain = origins.TransactionsDomain
-			fact.Entity.Domain = ""
-			fact.Entity.Name = fmt.Sprint(tx.ID)
+	// Attribute-based macro. These are expanded by the pipeline since they
+	// depend on the current state of the entity.
+	if fact.Attribute.Domain == origins.MacrosDomain {
+		if fact.Attribute.Name != origins.EntityMacro {
+			return fmt.Errorf("transactor(%d): unknown attribute macro: %s", tx.ID, fact.Attribute.Name)
+		}
 
-		default:
-			return fmt.Errorf("transactor(%d): unknown entity macro: %s", tx.ID, fact.Entity.Name)
+		if fact.Operation != origins.Retraction {
+			return fmt.Errorf("transactor(%d): entity macro can only be retracted", tx.ID)
 		}
 	}
 
 	// Value-based macro.
 	if fact.Value.Domain == origins.MacrosDomain {
-		switch fact.Value.Name {
+		if err := tx.expand(valueMacros, "value", fact, fact.Value); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// resolveTempid returns the identity the temporary ID resolves to. A new
+// identity is minted in the domain the first time the ID is seen.
+func (tx *Transaction) resolveTempid(name, domain string) (*origins.Ident, error) {
+	if id, ok := tx.tempids[name]; ok {
+		return id, nil
+	}
 
-		// Set the value to the transaction time.
-		case "now":
-			fact.Value.Domain = ""
-			fact.Value.Name = tx.StartTime.String()
+	id := &origins.Ident{
+		Domain: domain,
+	}
 
-		// Set the value to the transaction entity.
-		case "tx":
-			fact.Value.Domain = origins.TransactionsDomain
-			fact.Value.Name = fmt.Sprint(tx.ID)
+	if tx.options.TempidSequence {
+		n, err := tx.Engine.Incr(domain, "tempid")
 
-		default:
-			return fmt.Errorf("transactor(%s): unknown value macro: %s", tx.ID, fact.Value.Name)
+		if err != nil {
+			return nil, err
+		}
+
+		id.Name = fmt.Sprint(n)
+	} else {
+		id.Name = uuid.NewV4().String()
+	}
+
+	tx.tempids[name] = id
+
+	return id, nil
+}
+
+// tempid replaces temporary IDs in the entity and value of the fact with
+// the identities they resolve to.
+func (tx *Transaction) tempid(fact *origins.Fact) error {
+	if fact.Entity.Domain == origins.TempidsDomain {
+		id, err := tx.resolveTempid(fact.Entity.Name, fact.Domain)
+
+		if err != nil {
+			return err
+		}
+
+		fact.Entity = &origins.Ident{
+			Domain: id.Domain,
+			Name:   id.Name,
+		}
+	}
+
+	if fact.Value.Domain == origins.TempidsDomain {
+		id, err := tx.resolveTempid(fact.Value.Name, fact.Domain)
+
+		if err != nil {
+			return err
+		}
+
+		fact.Value = &origins.Ident{
+			Domain: id.Domain,
+			Name:   id.Name,
 		}
 	}
 
 	return nil
 }
 
+// authorize returns an error if the fact may not be written to its domain.
+// The domain is checked prior to macro expansion, so the macros that write
+// to reserved domains on behalf of the user are permitted.
+func (tx *Transaction) authorize(fact *origins.Fact) error {
+	if reserved(fact.Domain) {
+		if !tx.options.Privileged {
+			logrus.Debugf("transactor(%d): domain %s is reserved", tx.ID, fact.Domain)
+			return ErrReservedDomain
+		}
+
+		return nil
+	}
+
+	readOnly, ok := tx.readOnly[fact.Domain]
+
+	if !ok {
+		var err error
+
+		if readOnly, err = ReadOnly(tx.Engine, fact.Domain); err != nil {
+			return err
+		}
+
+		tx.readOnly[fact.Domain] = readOnly
+	}
+
+	if readOnly {
+		logrus.Debugf("transactor(%d): domain %s is read-only", tx.ID, fact.Domain)
+		return ErrReadOnlyDomain
+	}
+
+	return nil
+}
+
 // route uses the router to get the pipeline for the fact.
 func (tx *Transaction) route(fact *origins.Fact, track bool) error {
 	var (
@@ -231,31 +705,102 @@ func (tx *Transaction) route(fact *origins.Fact, track bool) error {
 		return err
 	}
 
+	// Facts about the transaction itself are written by the transactor.
+	user := track && fact.Entity != tx.entity
+
+	if user {
+		if err = tx.authorize(fact); err != nil {
+			return err
+		}
+	}
+
 	// Convert.
 	if err = tx.macro(fact); err != nil {
 		return err
 	}
 
+	// The read-only flag may be set using the domain macro.
+	if user && !tx.options.Privileged && fact.Domain == origins.DomainsDomain && fact.Attribute.Name == ReadOnlyAttr {
+		logrus.Debugf("transactor(%d): read-only flag of %s requires privilege", tx.ID, fact.Entity.Name)
+		return ErrReservedDomain
+	}
+
+	if err = tx.tempid(fact); err != nil {
+		return err
+	}
+
 	// Initialize a pipeline for the domain if one does not exit.
 	if pipe, ok = tx.pipes[fact.Domain]; !ok {
+		// Domains written to by facts about the transaction itself
+		// are not counted.
+		if user {
+			if tx.options.MaxDomains > 0 && tx.ndomains >= tx.options.MaxDomains {
+				return &LimitError{
+					Limit: LimitDomains,
+					Max:   int64(tx.options.MaxDomains),
+				}
+			}
+
+			tx.ndomains++
+		}
+
+		pipe = tx.spawn(fact.Domain)
+
+		// Guard against concurrent reads of the progress.
+		tx.mu.Lock()
+
 		if track {
 			tx.domains = append(tx.domains, fact.Domain)
 		}
 
-		pipe = tx.spawn(fact.Domain)
 		tx.pipes[fact.Domain] = pipe
+
+		tx.mu.Unlock()
+	}
+
+	// Send fact to the pipeline. An error may occur in a pipeline while
+	// it is being sent.
+	select {
+	case pipe.receiver <- fact:
+	case err = <-tx.errch:
+		return err
 	}
 
-	// Send fact to the pipeline.
-	pipe.receiver <- fact
+	if user {
+		atomic.AddInt64(&tx.routed, 1)
+	}
 
 	return nil
 }
 
+// reportProgress calls the function with the progress of the transaction at
+// each interval until the stop channel is closed.
+func (tx *Transaction) reportProgress(f func(*Progress), interval time.Duration, stop <-chan struct{}) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			f(tx.Progress())
+		case <-stop:
+			return
+		}
+	}
+}
+
 func (tx *Transaction) run() {
+	stop := make(chan struct{})
+
+	if f := tx.options.OnProgress; f != nil && tx.options.ProgressInterval > 0 {
+		go tx.reportProgress(f, tx.options.ProgressInterval, stop)
+	}
+
 	// Start the receiver. This blocks until the stream ends or is interrupted.
 	err := tx.receive()
 
+	close(tx.stopped)
+
 	if err == nil {
 		// Collect the domains affected across transacted facts and generates
 		// facts about them.
@@ -343,6 +888,17 @@ func (tx *Transaction) run() {
 	// Wait for the pipelines to finish there work.
 	tx.pipewg.Wait()
 
+	// An error occurred after facts stopped being received.
+	tx.mu.Lock()
+
+	if tx.Error == nil && tx.lateErr != nil {
+		tx.Error = tx.lateErr
+	}
+
+	tx.mu.Unlock()
+
+	close(stop)
+
 	// Complete the transaction by committing or aborting.
 	tx.complete()
 
@@ -359,12 +915,17 @@ func (tx *Transaction) receive() error {
 
 	logrus.Debugf("transactor(%d): begin receiving facts", tx.ID)
 
+	var deadline <-chan time.Time
+
+	if tx.options.MaxDuration > 0 {
+		deadline = time.After(tx.options.MaxDuration - time.Since(tx.StartTime))
+	}
+
 	for {
 		select {
 		// An error occurred in a pipeline.
 		case err = <-tx.errch:
 			logrus.Debugf("transactor(%d): %s", tx.ID, err)
-			close(tx.stream)
 			return err
 
 		// Receive facts from stream and route to pipeline.
@@ -375,11 +936,32 @@ func (tx *Transaction) receive() error {
 				return nil
 			}
 
+			// Facts about the transaction itself are not counted.
+			if fact.Entity != tx.entity {
+				atomic.AddInt64(&tx.received, 1)
+			}
+
+			if tx.options.MaxFacts > 0 && atomic.LoadInt64(&tx.received) > int64(tx.options.MaxFacts) {
+				return &LimitError{
+					Limit: LimitFacts,
+					Max:   int64(tx.options.MaxFacts),
+				}
+			}
+
 			if err = tx.route(fact, true); err != nil {
 				logrus.Debugf("transactor(%d): error routing fact", tx.ID)
 				return err
 			}
 
+		// Transaction exceeded the maximum duration.
+		case <-deadline:
+			logrus.Debugf("transactor(%d): duration limit exceeded", tx.ID)
+
+			return &LimitError{
+				Limit: LimitDuration,
+				Max:   int64(tx.options.MaxDuration),
+			}
+
 		// Transaction timeout.
 		case <-time.After(tx.options.ReceiveWait):
 			logrus.Debugf("transactor(%d): receive timeout", tx.ID)
@@ -395,8 +977,9 @@ func (tx *Transaction) receive() error {
 func (tx *Transaction) complete() {
 	var err error
 
-	// No error in the transaction, commit the transaction.
-	if tx.Error == nil {
+	// No error in the transaction, commit the transaction unless it is
+	// only being previewed.
+	if tx.Error == nil && !tx.options.Preview {
 		if err = tx.commit(); err != nil {
 			logrus.Errorf("transactor(%d): commit failed: %s", tx.ID, err)
 		} else {
@@ -406,14 +989,24 @@ func (tx *Transaction) complete() {
 
 	// Error occurred in the transaction or during the commit. Attempt to abort.
 	// TODO: if the abort fails, how can the storage garbage be reclaimed?
-	if tx.Error != nil || err != nil {
-		if err = tx.abort(); err != nil {
-			logrus.Errorf("transactor(%d): abort failed: %s", tx.ID, err)
+	if tx.Error != nil || err != nil || tx.options.Preview {
+		if aerr := tx.abort(); aerr != nil {
+			logrus.Errorf("transactor(%d): abort failed: %s", tx.ID, aerr)
+
+			if err == nil {
+				err = aerr
+			}
 		} else {
 			logrus.Debugf("transactor(%d): abort succeeded", tx.ID)
 		}
 	}
 
+	// A transaction with the same idempotency key committed first, so this
+	// one is reported as a replay of it.
+	if err == ErrDuplicateKey && tx.replayed != nil {
+		err = nil
+	}
+
 	if err != nil {
 		logrus.Errorf("transactor(%d): error writing transaction record: %s", tx.ID, err)
 	}
@@ -423,7 +1016,36 @@ func (tx *Transaction) complete() {
 
 // commit commits all the pipelines in a transaction.
 func (tx *Transaction) commit() error {
+	key := tx.options.IdempotencyKey
+
 	return tx.Engine.Multi(func(etx storage.Tx) error {
+		// Another transaction with the same key committed in the meantime.
+		if key != "" {
+			if info, err := getIdempotent(etx, key); err != nil {
+				return err
+			} else if info != nil {
+				info.Replayed = true
+				tx.replayed = info
+				return ErrDuplicateKey
+			}
+		}
+
+		// A domain may have been flagged read-only since it was checked.
+		for domain := range tx.readOnly {
+			if ro, err := readOnly(etx, domain); err != nil {
+				return err
+			} else if ro {
+				logrus.Debugf("transactor(%d): domain %s became read-only", tx.ID, domain)
+				return ErrReadOnlyDomain
+			}
+		}
+
+		if tx.prepare != nil {
+			if err := tx.prepare(etx); err != nil {
+				return err
+			}
+		}
+
 		for _, pipe := range tx.pipes {
 			if err := pipe.Commit(etx); err != nil {
 				return err
@@ -432,6 +1054,10 @@ func (tx *Transaction) commit() error {
 			logrus.Debugf("transactor(%d): committed pipeline %v", tx.ID, pipe)
 		}
 
+		if key != "" {
+			return setIdempotent(etx, key, tx.Info())
+		}
+
 		return nil
 	})
 }
@@ -458,6 +1084,10 @@ func (tx *Transaction) spawn(domain string) *Pipeline {
 		receiver: make(chan *origins.Fact),
 	}
 
+	if tx.options.BulkLoad {
+		pipe.receiver = make(chan *origins.Fact, tx.options.BufferSize)
+	}
+
 	tx.pipewg.Add(1)
 
 	go func() {
@@ -474,24 +1104,42 @@ func (tx *Transaction) spawn(domain string) *Pipeline {
 		// Initialize the pipeline. If an error occurs, send it to the transaction's error channel
 		// which will trigger the cancellation procedure.
 		if err = pipe.Init(tx); err != nil {
-			tx.errch <- err
-			return
+			tx.fail(err)
+		} else {
+			logrus.Debugf("transactor(%d): initialized pipeline %T(%s)", tx.ID, pipe, pipe)
 		}
 
-		logrus.Debugf("transactor(%d): initialized pipeline %T(%s)", tx.ID, pipe, pipe)
+		// Once an error occurs, the remaining facts are discarded.
+		handle := func(fact *origins.Fact) {
+			if err != nil {
+				return
+			}
+
+			if err = pipe.Handle(fact); err != nil {
+				tx.fail(err)
+			}
+		}
 
-		// Reads facts from the channel until there are no more or break
-		// if an error occurs from the pipeline.
+		// Reads facts from the channel until the transaction is done.
 		for {
 			select {
 			case <-tx.done:
+				// No more facts are sent once the transaction is done, so
+				// the facts left in a buffered channel can be drained.
+				for len(pipe.receiver) > 0 {
+					handle(<-pipe.receiver)
+				}
+
+				// Facts written in bulk are flushed even if an error
+				// occurred so all of the written blocks can be aborted.
+				if xerr := pipe.Flush(); xerr != nil && err == nil {
+					tx.fail(xerr)
+				}
+
 				return
 
 			case fact = <-pipe.receiver:
-				if err = pipe.Handle(fact); err != nil {
-					tx.errch <- err
-					return
-				}
+				handle(fact)
 			}
 		}
 	}()
@@ -499,15 +1147,42 @@ func (tx *Transaction) spawn(domain string) *Pipeline {
 	return pipe
 }
 
-// Write writes a fact to the transaction.
+// fail sends the error to the transaction. If the transaction has already
+// stopped receiving facts, the error is kept to abort it when it completes.
+func (tx *Transaction) fail(err error) {
+	select {
+	case tx.errch <- err:
+	case <-tx.stopped:
+		tx.mu.Lock()
+
+		if tx.lateErr == nil {
+			tx.lateErr = err
+		}
+
+		tx.mu.Unlock()
+	}
+}
+
+// Write writes a fact to the transaction. If the transaction has stopped
+// receiving facts due to an error, the error is returned.
 func (tx *Transaction) Write(fact *origins.Fact) error {
-	tx.stream <- fact
-	return nil
+	select {
+	case <-tx.done:
+		return tx.Error
+	default:
+	}
+
+	select {
+	case tx.stream <- fact:
+		return nil
+	case <-tx.done:
+		return tx.Error
+	}
 }
 
 // Cancel cancels the transaction.
 func (tx *Transaction) Cancel() error {
-	tx.errch <- ErrCanceled
+	tx.fail(ErrCanceled)
 	tx.mainwg.Wait()
 	return tx.Error
 }
@@ -520,6 +1195,51 @@ func (tx *Transaction) Commit() error {
 	return tx.Error
 }
 
+// replay returns a transaction that discards the facts written to it and
+// reports the info of the committed transaction with the same idempotency key.
+func replay(info *Info, options Options) *Transaction {
+	info.Replayed = true
+
+	tx := Transaction{
+		ID:        info.ID,
+		StartTime: info.StartTime,
+		EndTime:   info.EndTime,
+		options:   options,
+		pipes:     make(map[string]*Pipeline),
+		stream:    make(chan *origins.Fact, options.BufferSize),
+		done:      make(chan struct{}),
+		stopped:   make(chan struct{}),
+		errch:     make(chan error),
+		pipewg:    &sync.WaitGroup{},
+		mainwg:    &sync.WaitGroup{},
+		replayed:  info,
+	}
+
+	tx.mainwg.Add(1)
+
+	go func() {
+		defer func() {
+			close(tx.stopped)
+			close(tx.done)
+			tx.mainwg.Done()
+		}()
+
+		for {
+			select {
+			case tx.Error = <-tx.errch:
+				return
+
+			case fact := <-tx.stream:
+				if fact == nil {
+					return
+				}
+			}
+		}
+	}()
+
+	return &tx
+}
+
 // New initializes and returns a transaction for passed storage engine. The options
 // are used to change the behavior of the transaction itself.
 func New(engine storage.Engine, options Options) (*Transaction, error) {
@@ -531,6 +1251,45 @@ func New(engine storage.Engine, options Options) (*Transaction, error) {
 	// Start time of the transaction.
 	startTime := time.Now().UTC()
 
+	// Validate the metadata attributes before starting.
+	meta := make(origins.Facts, 0, len(options.Meta))
+
+	for k, v := range options.Meta {
+		attr, err := metaAttr(k)
+
+		if err != nil {
+			return nil, err
+		}
+
+		meta = append(meta, &origins.Fact{
+			Domain:    origins.TransactionsDomain,
+			Attribute: attr,
+			Value: &origins.Ident{
+				Name: v,
+			},
+		})
+	}
+
+	origins.Sort(meta, origins.AttributeComparator)
+
+	if options.BufferSize == 0 {
+		options.BufferSize = DefaultOptions.BufferSize
+	}
+
+	// A transaction with the same key has already been committed.
+	if options.IdempotencyKey != "" {
+		info, err := getIdempotent(engine, options.IdempotencyKey)
+
+		if err != nil {
+			return nil, err
+		}
+
+		if info != nil {
+			logrus.Debugf("transactor: replaying transaction %d for key %s", info.ID, options.IdempotencyKey)
+			return replay(info, options), nil
+		}
+	}
+
 	// Increment the transaction ID.
 	if id, err = txid(engine); err != nil {
 		logrus.Errorf("transactor: could not create transaction: %s", err)
@@ -541,8 +1300,11 @@ func New(engine storage.Engine, options Options) (*Transaction, error) {
 		options.ReceiveWait = DefaultOptions.ReceiveWait
 	}
 
-	if options.BufferSize == 0 {
-		options.BufferSize = DefaultOptions.BufferSize
+	templates, err := loadTemplates(engine)
+
+	if err != nil {
+		logrus.Errorf("transactor: could not load macros: %s", err)
+		return nil, err
 	}
 
 	tx := Transaction{
@@ -553,6 +1315,7 @@ func New(engine storage.Engine, options Options) (*Transaction, error) {
 		pipes:     make(map[string]*Pipeline),
 		stream:    make(chan *origins.Fact, options.BufferSize),
 		done:      make(chan struct{}),
+		stopped:   make(chan struct{}),
 		errch:     make(chan error),
 		pipewg:    &sync.WaitGroup{},
 		mainwg:    &sync.WaitGroup{},
@@ -560,6 +1323,10 @@ func New(engine storage.Engine, options Options) (*Transaction, error) {
 		entity: &origins.Ident{
 			Name: fmt.Sprint(id),
 		},
+
+		templates: templates,
+		tempids:   make(map[string]*origins.Ident),
+		readOnly:  make(map[string]bool),
 	}
 
 	tx.mainwg.Add(1)
@@ -592,5 +1359,10 @@ func New(engine storage.Engine, options Options) (*Transaction, error) {
 		},
 	})
 
+	for _, fact := range meta {
+		fact.Entity = tx.entity
+		tx.Write(fact)
+	}
+
 	return &tx, nil
 }
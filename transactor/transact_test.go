@@ -1,14 +1,20 @@
 package transactor
 
 import (
+	"bytes"
 	"fmt"
+	"os"
+	"strings"
 	"sync"
 	"testing"
+	"time"
 
 	"github.com/chop-dbhi/origins"
 	"github.com/chop-dbhi/origins/dal"
+	"github.com/chop-dbhi/origins/schema"
 	"github.com/chop-dbhi/origins/storage"
 	"github.com/chop-dbhi/origins/testutil"
+	"github.com/chop-dbhi/origins/view"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -150,6 +156,1252 @@ func TestRedundant(t *testing.T) {
 	assert.Equal(t, l1.Head, l2.Head)
 }
 
+// transactCSV transacts the CSV-formatted facts and returns the committed
+// transaction.
+func transactCSV(t *testing.T, engine storage.Engine, options Options, data string) *Transaction {
+	tx, err := New(engine, options)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err = origins.Copy(origins.NewCSVReader(bytes.NewBufferString(data)), tx); err != nil {
+		t.Fatal(err)
+	}
+
+	if err = tx.Commit(); err != nil {
+		t.Fatal(err)
+	}
+
+	return tx
+}
+
+// txFacts returns the facts in the domain that were written by the transaction.
+func txFacts(t *testing.T, engine storage.Engine, domain string, id uint64) origins.Facts {
+	log, err := view.OpenLog(engine, domain, "commit")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	facts, err := origins.ReadAll(origins.Filter(log.Now(), func(f *origins.Fact) bool {
+		return f.Transaction == id
+	}))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return facts
+}
+
+func TestCardinalityOne(t *testing.T) {
+	engine, _ := origins.Init("mem", nil)
+
+	options := DefaultOptions
+	options.DefaultDomain = "test"
+	options.Cardinalities = map[string]schema.Cardinality{
+		"test/city": schema.One,
+	}
+
+	transactCSV(t, engine, options, `
+entity,attribute,value
+bob,city,Norristown
+bob,likes,soccer
+`)
+
+	tx := transactCSV(t, engine, options, `
+entity,attribute,value
+bob,city,Bethlehem
+bob,likes,football
+`)
+
+	facts := txFacts(t, engine, "test", tx.ID)
+
+	assert.Equal(t, 3, len(facts))
+
+	assert.Equal(t, origins.Retraction, facts[0].Operation)
+	assert.Equal(t, "Norristown", facts[0].Value.Name)
+
+	assert.Equal(t, origins.Assertion, facts[1].Operation)
+	assert.Equal(t, "Bethlehem", facts[1].Value.Name)
+
+	assert.Equal(t, origins.Assertion, facts[2].Operation)
+	assert.Equal(t, "football", facts[2].Value.Name)
+}
+
+func TestCardinalityOneSchema(t *testing.T) {
+	engine, _ := origins.Init("mem", nil)
+
+	options := DefaultOptions
+	options.DefaultDomain = "test"
+
+	transactCSV(t, engine, options, `
+entity,attribute_domain,attribute,value_domain,value
+city,origins.attrs,cardinality,origins.cardinalities,one
+bob,,city,,Norristown
+`)
+
+	tx := transactCSV(t, engine, options, `
+entity,attribute,value
+bob,city,Bethlehem
+bob,city,Allentown
+`)
+
+	facts := txFacts(t, engine, "test", tx.ID)
+
+	// The second value in the same transaction retracts the first.
+	assert.Equal(t, 4, len(facts))
+
+	assert.Equal(t, origins.Retraction, facts[0].Operation)
+	assert.Equal(t, "Norristown", facts[0].Value.Name)
+
+	assert.Equal(t, origins.Retraction, facts[2].Operation)
+	assert.Equal(t, "Bethlehem", facts[2].Value.Name)
+
+	assert.Equal(t, "Allentown", facts[3].Value.Name)
+}
+
+func TestCardinalityDeclaredMany(t *testing.T) {
+	engine, _ := origins.Init("mem", nil)
+
+	options := DefaultOptions
+	options.DefaultDomain = "test"
+
+	// Declared without a cardinality.
+	transactCSV(t, engine, options, `
+entity,attribute_domain,attribute,value
+likes,origins.attrs,label,Likes
+bob,,likes,soccer
+`)
+
+	tx := transactCSV(t, engine, options, `
+entity,attribute,value
+bob,likes,football
+`)
+
+	facts := txFacts(t, engine, "test", tx.ID)
+
+	assert.Equal(t, 1, len(facts))
+	assert.Equal(t, origins.Assertion, facts[0].Operation)
+
+	state, err := dal.GetState(engine, "test", &origins.Ident{Domain: "test", Name: "bob"})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assert.Equal(t, 2, len(state))
+
+	for _, f := range state {
+		assert.Equal(t, origins.Assertion, f.Operation)
+	}
+}
+
+func TestStateIndex(t *testing.T) {
+	engine, _ := origins.Init("mem", nil)
+
+	options := DefaultOptions
+	options.DefaultDomain = "test"
+
+	tx1 := transactCSV(t, engine, options, `
+entity,attribute,value
+bob,city,Norristown
+bob,likes,soccer
+`)
+
+	tx2 := transactCSV(t, engine, options, `
+operation,entity,attribute,value
+retract,bob,likes,soccer
+assert,bob,city,Norristown
+`)
+
+	l := checkCommitted(t, engine, "test", tx2.ID)
+
+	state, _ := dal.GetLog(engine, "test", stateLogName)
+
+	assert.Equal(t, l.Head, state.Head)
+
+	facts, err := dal.GetState(engine, "test", &origins.Ident{Domain: "test", Name: "bob"})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assert.Equal(t, 2, len(facts))
+
+	assert.Equal(t, "Norristown", facts[0].Value.Name)
+	assert.Equal(t, tx1.ID, facts[0].Transaction)
+
+	assert.Equal(t, origins.Retraction, facts[1].Operation)
+	assert.Equal(t, tx2.ID, facts[1].Transaction)
+
+	// Only the retraction is new.
+	assert.Equal(t, 1, len(txFacts(t, engine, "test", tx2.ID)))
+}
+
+func TestStateIndexRebuild(t *testing.T) {
+	engine, _ := origins.Init("mem", nil)
+
+	options := DefaultOptions
+	options.DefaultDomain = "test"
+
+	tx1 := transactCSV(t, engine, options, `
+entity,attribute,value
+bob,city,Norristown
+`)
+
+	// Simulate a domain written to prior to the index.
+	dal.DeleteLog(engine, "test", stateLogName)
+	dal.DeleteState(engine, "test", &origins.Ident{Domain: "test", Name: "bob"})
+
+	tx2 := transactCSV(t, engine, options, `
+entity,attribute,value
+bob,city,Norristown
+`)
+
+	// The duplicate is still detected.
+	checkCommitted(t, engine, "test", tx1.ID)
+
+	l, _ := dal.GetLog(engine, "test", commitLogName)
+	state, _ := dal.GetLog(engine, "test", stateLogName)
+
+	assert.Equal(t, l.Head, state.Head)
+
+	facts, _ := dal.GetState(engine, "test", &origins.Ident{Domain: "test", Name: "bob"})
+
+	assert.Equal(t, 1, len(facts))
+	assert.Equal(t, 0, len(txFacts(t, engine, "test", tx2.ID)))
+}
+
+// waitWritten waits for the transaction to write a fact to the domain.
+func waitWritten(t *testing.T, tx *Transaction, domain string) {
+	deadline := time.Now().Add(5 * time.Second)
+
+	for {
+		for _, d := range tx.Progress().Domains {
+			if d.Domain == domain && d.Written > 0 {
+				return
+			}
+		}
+
+		if time.Now().After(deadline) {
+			t.Fatalf("no facts written to %s", domain)
+		}
+
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestStateIndexRebase(t *testing.T) {
+	engine, _ := origins.Init("mem", nil)
+
+	options := DefaultOptions
+	options.Privileged = true
+
+	tx1, _ := New(engine, options)
+
+	tx1.Write(&origins.Fact{
+		Domain:    origins.DomainsDomain,
+		Entity:    &origins.Ident{Name: "test"},
+		Attribute: &origins.Ident{Name: "label"},
+		Value:     &origins.Ident{Name: "Test"},
+	})
+
+	waitWritten(t, tx1, origins.DomainsDomain)
+
+	// Commits to the domains domain while tx1 is running.
+	transactCSV(t, engine, options, `
+domain,entity,attribute,value
+origins.domains,test,owner,bob
+`)
+
+	if err := tx1.Commit(); err != nil {
+		t.Fatal(err)
+	}
+
+	assert.True(t, tx1.pipes[origins.DomainsDomain].rebased)
+
+	// The rebased segment is applied to the state written in the meantime.
+	facts, _ := dal.GetState(engine, origins.DomainsDomain, &origins.Ident{
+		Domain: origins.DomainsDomain,
+		Name:   "test",
+	})
+
+	attrs := make(map[string]bool)
+
+	for _, f := range facts {
+		attrs[f.Attribute.Name] = true
+	}
+
+	assert.True(t, attrs["label"])
+	assert.True(t, attrs["owner"])
+}
+
+func TestMacros(t *testing.T) {
+	engine, _ := origins.Init("mem", nil)
+
+	os.Setenv("ORIGINS_TEST_HOST", "example")
+	os.Setenv("ORIGINS_TEST_SECRET", "secret")
+
+	AllowEnv("ORIGINS_TEST_HOST")
+
+	RegisterValueMacro("upper", func(tx *Transaction, fact *origins.Fact, arg string) error {
+		fact.Value.Domain = ""
+		fact.Value.Name = strings.ToUpper(arg)
+		return nil
+	})
+
+	defer func() {
+		macrosMu.Lock()
+		delete(valueMacros, "upper")
+		delete(allowedEnv, "ORIGINS_TEST_HOST")
+		macrosMu.Unlock()
+	}()
+
+	options := DefaultOptions
+	options.DefaultDomain = "test"
+
+	// Templates are declared in the reserved macros domain.
+	privileged := options
+	privileged.Privileged = true
+
+	transactCSV(t, engine, privileged, `
+domain,entity,attribute,value
+origins.macros,site,template,{{env "ORIGINS_TEST_HOST"}}-{{.Domain}}
+`)
+
+	tx := transactCSV(t, engine, options, `
+entity_domain,entity,attribute,value_domain,value
+,bob,host,origins.macros,env.ORIGINS_TEST_HOST
+,bob,date,origins.macros,today
+,bob,name,origins.macros,upper.bob
+,bob,site,origins.macros,site
+origins.macros,site,code,,1
+`)
+
+	facts := txFacts(t, engine, "test", tx.ID)
+
+	assert.Equal(t, 5, len(facts))
+
+	assert.Equal(t, "example", facts[0].Value.Name)
+	assert.Equal(t, tx.StartTime.Format("2006-01-02"), facts[1].Value.Name)
+	assert.Equal(t, "BOB", facts[2].Value.Name)
+	assert.Equal(t, "example-test", facts[3].Value.Name)
+	assert.Equal(t, &origins.Ident{Domain: "test", Name: "example-test"}, facts[4].Entity)
+
+	// Redeclared templates are used by the next transaction.
+	transactCSV(t, engine, privileged, `
+domain,entity,attribute,value
+origins.macros,site,template,{{.Domain}}-site
+`)
+
+	tx = transactCSV(t, engine, options, `
+entity_domain,entity,attribute,value_domain,value
+,sue,site,origins.macros,site
+`)
+
+	facts = txFacts(t, engine, "test", tx.ID)
+
+	assert.Equal(t, 1, len(facts))
+	assert.Equal(t, "test-site", facts[0].Value.Name)
+
+	// Only allowed environment variables can be read.
+	err := commitCSV(t, engine, options, `
+entity_domain,entity,attribute,value_domain,value
+,bob,secret,origins.macros,env.ORIGINS_TEST_SECRET
+`)
+
+	assert.NotNil(t, err)
+}
+
+func TestUnknownMacro(t *testing.T) {
+	engine, _ := origins.Init("mem", nil)
+
+	options := DefaultOptions
+	options.DefaultDomain = "test"
+
+	tx, _ := New(engine, options)
+
+	origins.Copy(origins.NewCSVReader(bytes.NewBufferString(`
+entity,attribute,value_domain,value
+bob,city,origins.macros,nowhere
+`)), tx)
+
+	assert.NotNil(t, tx.Commit())
+
+	checkCanceled(t, engine, "test", tx.ID)
+}
+
+func TestTempids(t *testing.T) {
+	engine, _ := origins.Init("mem", nil)
+
+	options := DefaultOptions
+	options.DefaultDomain = "test"
+	options.TempidSequence = true
+
+	tx := transactCSV(t, engine, options, `
+entity_domain,entity,attribute,value_domain,value
+origins.tempids,bob,name,,Bob
+origins.tempids,sue,name,,Sue
+origins.tempids,sue,knows,origins.tempids,bob
+`)
+
+	facts := txFacts(t, engine, "test", tx.ID)
+
+	assert.Equal(t, 3, len(facts))
+
+	bob := &origins.Ident{Domain: "test", Name: "1"}
+	sue := &origins.Ident{Domain: "test", Name: "2"}
+
+	assert.Equal(t, bob, facts[0].Entity)
+	assert.Equal(t, sue, facts[1].Entity)
+	assert.Equal(t, sue, facts[2].Entity)
+	assert.Equal(t, bob, facts[2].Value)
+
+	info := tx.Info()
+
+	assert.Equal(t, bob, info.Tempids["bob"])
+	assert.Equal(t, sue, info.Tempids["sue"])
+}
+
+func TestMeta(t *testing.T) {
+	engine, _ := origins.Init("mem", nil)
+
+	meta, err := ParseMeta([]string{"author=jdoe", "reason = Monthly import", "ticket=ORG-12"})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	options := DefaultOptions
+	options.DefaultDomain = "test"
+	options.Meta = meta
+
+	tx := transactCSV(t, engine, options, `
+entity,attribute,value
+bob,city,Norristown
+`)
+
+	facts := origins.Filter(origins.NewBuffer(txFacts(t, engine, origins.TransactionsDomain, tx.ID)), func(f *origins.Fact) bool {
+		_, ok := meta[f.Attribute.Name]
+		return ok
+	})
+
+	values := make(map[string]string)
+
+	origins.Map(facts, func(f *origins.Fact) error {
+		assert.Equal(t, fmt.Sprint(tx.ID), f.Entity.Name)
+		values[f.Attribute.Name] = f.Value.Name
+		return nil
+	})
+
+	assert.Equal(t, meta, values)
+	assert.Equal(t, "Monthly import", values["reason"])
+
+	_, err = ParseMeta([]string{"author"})
+
+	assert.NotNil(t, err)
+
+	_, err = ParseMeta([]string{" =jdoe"})
+
+	assert.NotNil(t, err)
+
+	_, err = ParseMeta([]string{"startTime=2015-01-01"})
+
+	assert.NotNil(t, err)
+
+	// Metadata supplied directly is validated too.
+	options.Meta = map[string]string{
+		"origins.transactions/endTime": "2015-01-01",
+	}
+
+	_, err = New(engine, options)
+
+	assert.NotNil(t, err)
+}
+
+func TestPreview(t *testing.T) {
+	engine, _ := origins.Init("mem", nil)
+
+	options := DefaultOptions
+	options.DefaultDomain = "test"
+	options.Cardinalities = map[string]schema.Cardinality{
+		"test/city": schema.One,
+	}
+
+	tx1 := transactCSV(t, engine, options, `
+entity,attribute,value
+bob,city,Norristown
+bob,likes,soccer
+`)
+
+	options.Preview = true
+
+	tx2 := transactCSV(t, engine, options, `
+operation,entity,attribute,value
+assert,bob,city,Bethlehem
+assert,bob,likes,soccer
+retract,bob,likes,soccer
+assert,sue,city,Allentown
+`)
+
+	// Nothing is committed.
+	checkCommitted(t, engine, "test", tx1.ID)
+	checkCommitted(t, engine, origins.TransactionsDomain, tx1.ID)
+
+	pv, err := tx2.Preview()
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var facts origins.Facts
+
+	for _, f := range pv.Facts {
+		if f.Domain == "test" {
+			facts = append(facts, f)
+		}
+	}
+
+	// The implied retraction is included, the duplicate is not.
+	assert.Equal(t, 4, len(facts))
+	assert.Equal(t, origins.Retraction, facts[0].Operation)
+	assert.Equal(t, "Norristown", facts[0].Value.Name)
+
+	var events []*view.Event
+
+	for _, e := range pv.Events {
+		if e.Entity.Domain == "test" {
+			events = append(events, e)
+		}
+	}
+
+	assert.Equal(t, 3, len(events))
+
+	assert.Equal(t, view.Change, events[0].Type)
+	assert.Equal(t, "Norristown", events[0].Before.Value.Name)
+	assert.Equal(t, "Bethlehem", events[0].After.Value.Name)
+
+	assert.Equal(t, view.Remove, events[1].Type)
+	assert.Equal(t, "soccer", events[1].Before.Value.Name)
+
+	assert.Equal(t, view.Add, events[2].Type)
+	assert.Equal(t, "Allentown", events[2].After.Value.Name)
+
+	var buf bytes.Buffer
+
+	if err = pv.WriteCSV(&buf); err != nil {
+		t.Fatal(err)
+	}
+
+	assert.Contains(t, buf.String(), "change,test,bob,test,city,,Norristown,,Bethlehem")
+}
+
+func TestIdempotencyKey(t *testing.T) {
+	engine, _ := origins.Init("mem", nil)
+
+	options := DefaultOptions
+	options.DefaultDomain = "test"
+	options.IdempotencyKey = "import-1"
+
+	tx1 := transactCSV(t, engine, options, `
+entity,attribute,value
+bob,city,Norristown
+`)
+
+	assert.False(t, tx1.Info().Replayed)
+
+	// Retry with different facts, nothing is written.
+	tx2 := transactCSV(t, engine, options, `
+entity,attribute,value
+bob,city,Bethlehem
+sue,city,Allentown
+`)
+
+	info := tx2.Info()
+
+	assert.True(t, info.Replayed)
+	assert.Equal(t, tx1.ID, info.ID)
+	assert.Equal(t, tx1.Info().Count, info.Count)
+
+	checkCommitted(t, engine, "test", tx1.ID)
+
+	assert.Equal(t, 1, len(txFacts(t, engine, "test", tx1.ID)))
+
+	// A different key is committed.
+	options.IdempotencyKey = "import-2"
+
+	tx3 := transactCSV(t, engine, options, `
+entity,attribute,value
+bob,city,Bethlehem
+`)
+
+	assert.False(t, tx3.Info().Replayed)
+	assert.NotEqual(t, tx1.ID, tx3.ID)
+
+	checkCommitted(t, engine, "test", tx3.ID)
+}
+
+func TestIdempotencyKeyConcurrent(t *testing.T) {
+	engine, _ := origins.Init("mem", nil)
+
+	options := DefaultOptions
+	options.DefaultDomain = "test"
+	options.IdempotencyKey = "import-1"
+
+	// Both transactions start before either is committed.
+	txs := make([]*Transaction, 2)
+
+	for i := range txs {
+		tx, err := New(engine, options)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		txs[i] = tx
+	}
+
+	errs := make([]error, len(txs))
+
+	wg := sync.WaitGroup{}
+	wg.Add(len(txs))
+
+	for i, tx := range txs {
+		go func(i int, tx *Transaction) {
+			defer wg.Done()
+
+			origins.Copy(origins.NewCSVReader(bytes.NewBufferString(fmt.Sprintf(`
+entity,attribute,value
+bob,city,City %d
+`, i))), tx)
+
+			errs[i] = tx.Commit()
+		}(i, tx)
+	}
+
+	wg.Wait()
+
+	for i, tx := range txs {
+		assert.Nil(t, errs[i])
+		assert.Nil(t, tx.CommitError)
+	}
+
+	winner, loser := txs[0], txs[1]
+
+	if winner.Info().Replayed {
+		winner, loser = loser, winner
+	}
+
+	info := loser.Info()
+
+	assert.False(t, winner.Info().Replayed)
+	assert.True(t, info.Replayed)
+	assert.Equal(t, winner.ID, info.ID)
+	assert.Equal(t, winner.Info().Count, info.Count)
+
+	checkCommitted(t, engine, "test", winner.ID)
+
+	assert.Equal(t, 0, len(txFacts(t, engine, "test", loser.ID)))
+}
+
+func TestRevert(t *testing.T) {
+	engine, _ := origins.Init("mem", nil)
+
+	options := DefaultOptions
+	options.DefaultDomain = "test"
+	options.Cardinalities = map[string]schema.Cardinality{
+		"test/city": schema.One,
+	}
+
+	transactCSV(t, engine, options, `
+entity,attribute,value
+bob,city,Norristown
+`)
+
+	tx1 := transactCSV(t, engine, options, `
+entity,attribute,value,time
+bob,city,Bethlehem,2015-03-01
+bob,likes,football,2015-03-01
+`)
+
+	tx2, err := Revert(engine, tx1.ID)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	checkCommitted(t, engine, "test", tx2.ID)
+
+	ops := make(map[string]origins.Operation)
+
+	for _, f := range txFacts(t, engine, "test", tx2.ID) {
+		ops[f.Value.Name] = f.Operation
+
+		// The inverse facts keep the time of the reverted facts.
+		assert.Equal(t, "2015-03-01", f.Time.Format("2006-01-02"))
+	}
+
+	assert.Equal(t, map[string]origins.Operation{
+		"Norristown": origins.Assertion,
+		"Bethlehem":  origins.Retraction,
+		"football":   origins.Retraction,
+	}, ops)
+
+	// The reverting transaction is linked to the original.
+	facts := origins.Filter(origins.NewBuffer(txFacts(t, engine, origins.TransactionsDomain, tx2.ID)), func(f *origins.Fact) bool {
+		return f.Attribute.Name == "reverts"
+	})
+
+	reverts, _ := origins.ReadAll(facts)
+
+	assert.Equal(t, 1, len(reverts))
+	assert.Equal(t, fmt.Sprint(tx2.ID), reverts[0].Entity.Name)
+	assert.Equal(t, fmt.Sprint(tx1.ID), reverts[0].Value.Name)
+
+	_, err = Revert(engine, 1000)
+
+	assert.Equal(t, ErrUnknownTransaction, err)
+}
+
+func TestExcise(t *testing.T) {
+	engine, _ := origins.Init("mem", nil)
+
+	options := DefaultOptions
+	options.DefaultDomain = "test"
+
+	tx1 := transactCSV(t, engine, options, `
+entity,attribute,value
+bob,city,Norristown
+bob,likes,soccer
+sue,city,Allentown
+`)
+
+	// Only bob's facts are in this segment.
+	transactCSV(t, engine, options, `
+entity,attribute,value
+bob,city,Bethlehem
+`)
+
+	tx3 := transactCSV(t, engine, options, `
+entity,attribute,value
+sue,likes,football
+`)
+
+	n, err := Excise(engine, Excision{
+		Domain: "test",
+		Entity: &origins.Ident{Name: "bob"},
+	})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assert.Equal(t, 3, n)
+
+	log, err := view.OpenLog(engine, "test", "commit")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	facts, err := origins.ReadAll(log.Now())
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The emptied segment is skipped.
+	assert.Equal(t, 2, len(facts))
+	assert.Equal(t, "football", facts[0].Value.Name)
+	assert.Equal(t, tx3.ID, facts[0].Transaction)
+	assert.Equal(t, "Allentown", facts[1].Value.Name)
+	assert.Equal(t, tx1.ID, facts[1].Transaction)
+
+	seg, _ := dal.GetSegment(engine, "test", checkCommitted(t, engine, "test", tx3.ID).Head)
+	seg, _ = dal.GetSegment(engine, "test", seg.Next)
+
+	assert.Equal(t, 0, seg.Count)
+	assert.Equal(t, 0, seg.Blocks)
+
+	state, _ := dal.GetState(engine, "test", &origins.Ident{Domain: "test", Name: "bob"})
+
+	assert.Equal(t, 0, len(state))
+
+	// The excision is recorded without the excised content.
+	facts, _ = origins.ReadAll(origins.Filter(origins.NewBuffer(txFacts(t, engine, origins.TransactionsDomain, tx3.ID+1)), func(f *origins.Fact) bool {
+		return f.Attribute.Name == "excised" || f.Attribute.Name == "excisedCount"
+	}))
+
+	assert.Equal(t, 2, len(facts))
+
+	for _, f := range facts {
+		assert.NotEqual(t, "bob", f.Value.Name)
+	}
+
+	// Nothing left to excise.
+	n, err = Excise(engine, Excision{
+		Domain: "test",
+		Entity: &origins.Ident{Name: "bob"},
+	})
+
+	assert.Nil(t, err)
+	assert.Equal(t, 0, n)
+
+	_, err = Excise(engine, Excision{
+		Domain: "test",
+	})
+
+	assert.Equal(t, ErrNoEntity, err)
+}
+
+func TestExciseAuditFailed(t *testing.T) {
+	engine, _ := origins.Init("mem", nil)
+
+	options := DefaultOptions
+	options.DefaultDomain = "test"
+
+	tx := transactCSV(t, engine, options, `
+entity,attribute,value
+bob,city,Norristown
+`)
+
+	// The audit transaction exceeds the limit, so nothing is excised.
+	max := DefaultOptions.MaxFacts
+	DefaultOptions.MaxFacts = 1
+	defer func() { DefaultOptions.MaxFacts = max }()
+
+	n, err := Excise(engine, Excision{
+		Domain: "test",
+		Entity: &origins.Ident{Name: "bob"},
+	})
+
+	assert.NotNil(t, err)
+	assert.Equal(t, 0, n)
+
+	assert.Equal(t, 1, len(txFacts(t, engine, "test", tx.ID)))
+
+	state, _ := dal.GetState(engine, "test", &origins.Ident{Domain: "test", Name: "bob"})
+
+	assert.Equal(t, 1, len(state))
+}
+
+func TestExciseAttribute(t *testing.T) {
+	engine, _ := origins.Init("mem", nil)
+
+	options := DefaultOptions
+	options.DefaultDomain = "test"
+
+	transactCSV(t, engine, options, `
+entity,attribute,value
+bob,city,Norristown
+bob,likes,soccer
+`)
+
+	n, err := Excise(engine, Excision{
+		Domain:    "test",
+		Entity:    &origins.Ident{Name: "bob"},
+		Attribute: &origins.Ident{Domain: "test", Name: "city"},
+	})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assert.Equal(t, 1, n)
+
+	state, _ := dal.GetState(engine, "test", &origins.Ident{Domain: "test", Name: "bob"})
+
+	assert.Equal(t, 1, len(state))
+	assert.Equal(t, "soccer", state[0].Value.Name)
+}
+
+func TestRetractEntity(t *testing.T) {
+	engine, _ := origins.Init("mem", nil)
+
+	options := DefaultOptions
+	options.DefaultDomain = "test"
+
+	transactCSV(t, engine, options, `
+entity,attribute,value
+bob,city,Norristown
+bob,likes,soccer
+bob,likes,football
+sue,city,Allentown
+`)
+
+	transactCSV(t, engine, options, `
+operation,entity,attribute,value
+retract,bob,likes,football
+`)
+
+	tx := transactCSV(t, engine, options, `
+operation,entity,attribute,value
+retract-entity,bob,,
+`)
+
+	facts := txFacts(t, engine, "test", tx.ID)
+
+	assert.Equal(t, 2, len(facts))
+
+	for _, f := range facts {
+		assert.Equal(t, origins.Retraction, f.Operation)
+		assert.Equal(t, "bob", f.Entity.Name)
+		assert.NotEqual(t, "football", f.Value.Name)
+	}
+
+	// Equivalent to the retracting the entity macro attribute.
+	tx = transactCSV(t, engine, options, `
+operation,entity,attribute_domain,attribute,value
+assert,sue,,likes,hockey
+retract,sue,origins.macros,entity,
+`)
+
+	facts = txFacts(t, engine, "test", tx.ID)
+
+	assert.Equal(t, 3, len(facts))
+	assert.Equal(t, origins.Retraction, facts[1].Operation)
+	assert.Equal(t, origins.Retraction, facts[2].Operation)
+
+	// Asserting the macro is an error.
+	tx, _ = New(engine, options)
+
+	tx.Write(&origins.Fact{
+		Entity:    &origins.Ident{Name: "bob"},
+		Attribute: &origins.Ident{Domain: origins.MacrosDomain, Name: origins.EntityMacro},
+		Value:     &origins.Ident{},
+	})
+
+	assert.NotNil(t, tx.Commit())
+}
+
+func TestLimits(t *testing.T) {
+	tests := map[Limit]Options{
+		LimitFacts:    {MaxFacts: 100},
+		LimitBytes:    {MaxBytes: 1000},
+		LimitDomains:  {MaxDomains: 2},
+		LimitDuration: {MaxDuration: 10 * time.Millisecond},
+	}
+
+	for limit, options := range tests {
+		engine, _ := origins.Init("mem", nil)
+
+		tx, err := New(engine, options)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if limit == LimitDomains {
+			for _, d := range []string{"a", "b", "c"} {
+				tx.Write(&origins.Fact{
+					Domain:    d,
+					Entity:    &origins.Ident{Name: "bob"},
+					Attribute: &origins.Ident{Name: "city"},
+					Value:     &origins.Ident{Name: "Norristown"},
+				})
+			}
+		} else {
+			if limit == LimitDuration {
+				time.Sleep(20 * time.Millisecond)
+			}
+
+			origins.Copy(testutil.NewRandGenerator("a", tx.ID, 2000), tx)
+		}
+
+		err = tx.Commit()
+
+		if lerr, ok := err.(*LimitError); !ok {
+			t.Errorf("%s: expected limit error, got %v", limit, err)
+		} else {
+			assert.Equal(t, limit, lerr.Limit)
+		}
+
+		checkCanceled(t, engine, "a", tx.ID)
+	}
+}
+
+func TestProgress(t *testing.T) {
+	engine, _ := origins.Init("mem", nil)
+
+	var (
+		mu      sync.Mutex
+		reports []*Progress
+	)
+
+	options := DefaultOptions
+
+	// Progress is reported by the pipelines as blocks are flushed.
+	options.OnProgress = func(p *Progress) {
+		mu.Lock()
+		reports = append(reports, p)
+		mu.Unlock()
+	}
+
+	tx, _ := New(engine, options)
+
+	done := make(chan struct{})
+
+	// Progress is read while facts are being written.
+	go func() {
+		defer close(done)
+
+		for i := 0; i < 10; i++ {
+			tx.Progress()
+			time.Sleep(time.Millisecond)
+		}
+	}()
+
+	origins.Copy(testutil.NewRandGenerator("test", tx.ID, 2500), tx)
+
+	<-done
+
+	if err := tx.Commit(); err != nil {
+		t.Fatal(err)
+	}
+
+	p := tx.Progress()
+
+	assert.Equal(t, 2500, p.Received)
+	assert.Equal(t, "test", p.Domains[1].Domain)
+
+	stats := tx.pipes["test"].Stats()
+
+	assert.Equal(t, stats.Count, p.Domains[1].Written)
+	assert.Equal(t, stats.Count/blockSize, p.Domains[1].Blocks)
+
+	assert.Equal(t, p.Blocks, len(reports))
+
+	for i, r := range reports {
+		assert.Equal(t, i+1, r.Blocks)
+	}
+}
+
+func TestProgressInterval(t *testing.T) {
+	engine, _ := origins.Init("mem", nil)
+
+	var (
+		mu      sync.Mutex
+		reports []*Progress
+	)
+
+	options := DefaultOptions
+	options.ProgressInterval = time.Millisecond
+
+	options.OnProgress = func(p *Progress) {
+		mu.Lock()
+		reports = append(reports, p)
+		mu.Unlock()
+	}
+
+	tx, _ := New(engine, options)
+
+	origins.Copy(testutil.NewRandGenerator("test", tx.ID, 10), tx)
+
+	// Progress is reported although no blocks are flushed.
+	time.Sleep(20 * time.Millisecond)
+
+	if err := tx.Commit(); err != nil {
+		t.Fatal(err)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+
+	if len(reports) == 0 {
+		t.Fatal("no progress reported")
+	}
+
+	last := reports[len(reports)-1]
+
+	assert.Equal(t, 10, last.Received)
+	assert.Equal(t, 10, last.Routed)
+	assert.Equal(t, 0, last.Blocks)
+}
+
+// commitCSV transacts the CSV data and returns the error of the commit.
+func commitCSV(t *testing.T, engine storage.Engine, options Options, data string) error {
+	tx, err := New(engine, options)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	origins.Copy(origins.NewCSVReader(bytes.NewBufferString(data)), tx)
+
+	return tx.Commit()
+}
+
+func TestReservedDomains(t *testing.T) {
+	engine, _ := origins.Init("mem", nil)
+
+	options := DefaultOptions
+	options.DefaultDomain = "test"
+
+	// Forged transaction metadata.
+	err := commitCSV(t, engine, options, `
+domain,entity,attribute,value
+origins.transactions,1,author,mallory
+`)
+
+	assert.Equal(t, ErrReservedDomain, err)
+
+	err = commitCSV(t, engine, options, `
+domain,entity,attribute,value
+origins.macros,site,template,{{.Domain}}
+`)
+
+	assert.Equal(t, ErrReservedDomain, err)
+
+	// Macros that write to reserved domains are permitted.
+	tx := transactCSV(t, engine, options, `
+entity_domain,entity,attribute,value
+origins.macros,tx,author,bob
+origins.macros,domain,description,Test domain
+`)
+
+	assert.Nil(t, tx.Error)
+
+	var described bool
+
+	for _, f := range txFacts(t, engine, origins.DomainsDomain, tx.ID) {
+		if f.Entity.Name == "test" && f.Attribute.Name == "description" {
+			described = true
+		}
+	}
+
+	assert.True(t, described)
+
+	// Privileged transactions may write to reserved domains.
+	options.Privileged = true
+
+	tx = transactCSV(t, engine, options, `
+domain,entity,attribute,value
+origins.attrs,city,cardinality,one
+`)
+
+	assert.Nil(t, tx.Error)
+	assert.Equal(t, 1, len(txFacts(t, engine, origins.AttrsDomain, tx.ID)))
+}
+
+func TestReadOnly(t *testing.T) {
+	engine, _ := origins.Init("mem", nil)
+
+	options := DefaultOptions
+	options.DefaultDomain = "test"
+
+	transactCSV(t, engine, options, `
+entity,attribute,value
+bob,city,Norristown
+`)
+
+	if _, err := SetReadOnly(engine, "test", true); err != nil {
+		t.Fatal(err)
+	}
+
+	readOnly, _ := ReadOnly(engine, "test")
+	assert.True(t, readOnly)
+
+	err := commitCSV(t, engine, options, `
+entity,attribute,value
+bob,city,Bethlehem
+`)
+
+	assert.Equal(t, ErrReadOnlyDomain, err)
+
+	// The flag cannot be unset without privilege.
+	err = commitCSV(t, engine, options, `
+domain,entity,attribute,value
+origins.domains,test,readOnly,false
+`)
+
+	assert.Equal(t, ErrReservedDomain, err)
+
+	options.DefaultDomain = "other"
+
+	// Or set using the domain macro.
+	err = commitCSV(t, engine, options, `
+entity_domain,entity,attribute,value
+origins.macros,domain,readOnly,true
+`)
+
+	assert.Equal(t, ErrReservedDomain, err)
+
+	// Other domains are not affected.
+	transactCSV(t, engine, options, `
+entity,attribute,value
+bob,city,Bethlehem
+`)
+
+	if _, err := SetReadOnly(engine, "test", false); err != nil {
+		t.Fatal(err)
+	}
+
+	readOnly, _ = ReadOnly(engine, "test")
+	assert.False(t, readOnly)
+
+	options.DefaultDomain = "test"
+
+	tx := transactCSV(t, engine, options, `
+entity,attribute,value
+bob,city,Bethlehem
+`)
+
+	assert.Equal(t, 1, len(txFacts(t, engine, "test", tx.ID)))
+
+	// The flag set by a privileged transaction using the domain macro.
+	options.DefaultDomain = "other"
+	options.Privileged = true
+
+	transactCSV(t, engine, options, `
+entity_domain,entity,attribute,value
+origins.macros,domain,readOnly,true
+`)
+
+	readOnly, _ = ReadOnly(engine, "other")
+	assert.True(t, readOnly)
+
+	options.Privileged = false
+
+	err = commitCSV(t, engine, options, `
+entity,attribute,value
+bob,city,Allentown
+`)
+
+	assert.Equal(t, ErrReadOnlyDomain, err)
+}
+
+func TestReadOnlyConcurrent(t *testing.T) {
+	engine, _ := origins.Init("mem", nil)
+
+	options := DefaultOptions
+	options.DefaultDomain = "test"
+
+	tx, _ := New(engine, options)
+
+	tx.Write(&origins.Fact{
+		Entity:    &origins.Ident{Name: "bob"},
+		Attribute: &origins.Ident{Name: "city"},
+		Value:     &origins.Ident{Name: "Norristown"},
+	})
+
+	waitWritten(t, tx, "test")
+
+	// The domain is flagged after the transaction checked it.
+	if _, err := SetReadOnly(engine, "test", true); err != nil {
+		t.Fatal(err)
+	}
+
+	tx.Commit()
+
+	assert.Equal(t, ErrReadOnlyDomain, tx.CommitError)
+	checkCanceled(t, engine, "test", tx.ID)
+
+	readOnly, _ := ReadOnly(engine, "test")
+	assert.True(t, readOnly)
+}
+
 func benchTransaction(b *testing.B, n int, m int) {
 	b.StopTimer()
 
@@ -0,0 +1,158 @@
+package view
+
+import (
+	"sort"
+	"time"
+
+	"github.com/chop-dbhi/origins"
+)
+
+// eaFacts are the facts about an entity and attribute before and after.
+type eaFacts struct {
+	entity    *origins.Ident
+	attribute *origins.Ident
+	before    origins.Facts
+	after     origins.Facts
+}
+
+// byEntityAttribute sorts the facts by entity then attribute.
+type byEntityAttribute []*eaFacts
+
+func (s byEntityAttribute) Len() int {
+	return len(s)
+}
+
+func (s byEntityAttribute) Swap(i, j int) {
+	s[i], s[j] = s[j], s[i]
+}
+
+func (s byEntityAttribute) Less(i, j int) bool {
+	if !s[i].entity.Is(s[j].entity) {
+		return origins.IdentComparator(s[i].entity, s[j].entity)
+	}
+
+	return origins.IdentComparator(s[i].attribute, s[j].attribute)
+}
+
+// without returns the facts whose value is not in the other facts.
+func without(facts, other origins.Facts) origins.Facts {
+	var out origins.Facts
+
+	for _, f := range facts {
+		found := false
+
+		for _, o := range other {
+			if f.Value.Is(o.Value) {
+				found = true
+				break
+			}
+		}
+
+		if !found {
+			out = append(out, f)
+		}
+	}
+
+	return out
+}
+
+// Diff returns the events that turn the state of the log as of the from time
+// into the state as of the to time. A zero from time is the empty state before
+// the first transaction and a zero to time is the current state. If a single
+// value of an attribute is replaced, a change event is returned, otherwise the
+// values are added and removed individually. Remove events do not have an
+// after fact. Events are ordered by entity and attribute.
+func Diff(log *Log, from, to time.Time) ([]*Event, error) {
+	var (
+		err           error
+		before, after origins.Facts
+	)
+
+	if !from.IsZero() {
+		if before, err = current(log.Asof(from)); err != nil {
+			return nil, err
+		}
+	}
+
+	if to.IsZero() {
+		to = time.Now()
+	}
+
+	if after, err = current(log.Asof(to)); err != nil {
+		return nil, err
+	}
+
+	var (
+		groups []*eaFacts
+		keys   = make(map[eaKey]*eaFacts)
+	)
+
+	group := func(f *origins.Fact) *eaFacts {
+		k := eaKey{*f.Entity, *f.Attribute}
+
+		g, ok := keys[k]
+
+		if !ok {
+			g = &eaFacts{
+				entity:    f.Entity,
+				attribute: f.Attribute,
+			}
+
+			keys[k] = g
+			groups = append(groups, g)
+		}
+
+		return g
+	}
+
+	for _, f := range before {
+		g := group(f)
+		g.before = append(g.before, f)
+	}
+
+	for _, f := range after {
+		g := group(f)
+		g.after = append(g.after, f)
+	}
+
+	sort.Stable(byEntityAttribute(groups))
+
+	var events []*Event
+
+	for _, g := range groups {
+		removed := without(g.before, g.after)
+		added := without(g.after, g.before)
+
+		if len(removed) == 1 && len(added) == 1 {
+			events = append(events, &Event{
+				Type:      Change,
+				Entity:    g.entity,
+				Attribute: g.attribute,
+				Before:    removed[0],
+				After:     added[0],
+			})
+
+			continue
+		}
+
+		for _, f := range removed {
+			events = append(events, &Event{
+				Type:      Remove,
+				Entity:    g.entity,
+				Attribute: g.attribute,
+				Before:    f,
+			})
+		}
+
+		for _, f := range added {
+			events = append(events, &Event{
+				Type:      Add,
+				Entity:    g.entity,
+				Attribute: g.attribute,
+				After:     f,
+			})
+		}
+	}
+
+	return events, nil
+}
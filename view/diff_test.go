@@ -0,0 +1,95 @@
+package view_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/chop-dbhi/origins"
+	"github.com/chop-dbhi/origins/testutil/txtest"
+	"github.com/chop-dbhi/origins/view"
+)
+
+func TestDiff(t *testing.T) {
+	engine, _ := origins.Init("memory", nil)
+
+	tx := txtest.TransactCSV(t, engine, "test", `
+entity,attribute,value
+bob,city,Norristown
+bob,likes,soccer
+sue,city,Allentown
+`)
+
+	txtest.TransactCSV(t, engine, "test", `
+operation,entity,attribute,value
+retract,bob,city,Norristown
+assert,bob,city,Bethlehem
+assert,bob,likes,football
+assert,bob,likes,tennis
+retract,sue,city,Allentown
+assert,joe,city,Easton
+`)
+
+	log := openLog(t, engine)
+
+	checkEvents := func(events []*view.Event, expected []string) {
+		if len(events) != len(expected) {
+			t.Fatalf("expected %d events, got %d", len(expected), len(events))
+		}
+
+		for i, e := range events {
+			var before, after string
+
+			if e.Before != nil {
+				before = e.Before.Value.Name
+			}
+
+			if e.After != nil {
+				after = e.After.Value.Name
+			}
+
+			s := e.Type.String() + " " + e.Entity.Name + " " + e.Attribute.Name + " " + before + " " + after
+
+			if s != expected[i] {
+				t.Errorf("expected %q, got %q", expected[i], s)
+			}
+		}
+	}
+
+	events, err := view.Diff(log, tx.EndTime, time.Time{})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	checkEvents(events, []string{
+		"change bob city Norristown Bethlehem",
+		"add bob likes  football",
+		"add bob likes  tennis",
+		"add joe city  Easton",
+		"remove sue city Allentown ",
+	})
+
+	// Reversed.
+	if events, err = view.Diff(log, time.Now(), tx.EndTime); err != nil {
+		t.Fatal(err)
+	}
+
+	checkEvents(events, []string{
+		"change bob city Bethlehem Norristown",
+		"remove bob likes football ",
+		"remove bob likes tennis ",
+		"remove joe city Easton ",
+		"add sue city  Allentown",
+	})
+
+	// From the empty state.
+	if events, err = view.Diff(log, time.Time{}, tx.EndTime); err != nil {
+		t.Fatal(err)
+	}
+
+	checkEvents(events, []string{
+		"add bob city  Norristown",
+		"add bob likes  soccer",
+		"add sue city  Allentown",
+	})
+}
@@ -0,0 +1,240 @@
+package view
+
+import (
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/chop-dbhi/origins"
+	"github.com/chop-dbhi/origins/chrono"
+	"github.com/chop-dbhi/origins/dal"
+	"github.com/chop-dbhi/origins/storage"
+	"github.com/satori/go.uuid"
+)
+
+var ErrNoEntity = errors.New("entity: does not exist")
+
+// Value is a value of an entity attribute with the metadata of the fact
+// that asserted it.
+type Value struct {
+	Value       *origins.Ident
+	Time        time.Time
+	Transaction uint64
+
+	// Entity the value refers to if references are followed.
+	Ref *EntityState
+}
+
+func (v *Value) MarshalJSON() ([]byte, error) {
+	m := map[string]interface{}{
+		"Value":       v.Value,
+		"Time":        chrono.JSON(v.Time),
+		"Transaction": v.Transaction,
+	}
+
+	if v.Ref != nil {
+		m["Ref"] = v.Ref
+	}
+
+	return json.Marshal(m)
+}
+
+// EntityState is the materialized state of an entity. The values of each
+// attribute are keyed by the fully qualified attribute identity.
+type EntityState struct {
+	Domain string
+	Ident  *origins.Ident
+	Attrs  map[string][]*Value
+}
+
+// Get returns the values of the attribute.
+func (e *EntityState) Get(attr *origins.Ident) []*Value {
+	return e.Attrs[attr.String()]
+}
+
+// puller materializes entities from the state of their domains. The current
+// state of an entity is read from the current-state index of its domain. If
+// the state is bounded by time or the index is out of date, the state of the
+// domain is read from its log once.
+type puller struct {
+	engine  storage.Engine
+	asof    time.Time
+	states  map[string]map[origins.Ident]origins.Facts
+	indexed map[string]bool
+}
+
+// useIndex returns true if the current-state index of the domain reflects
+// the head of its log and the state is not bounded by time.
+func (p *puller) useIndex(domain string) (bool, error) {
+	if !p.asof.IsZero() {
+		return false, nil
+	}
+
+	if ok, seen := p.indexed[domain]; seen {
+		return ok, nil
+	}
+
+	log, err := dal.GetLog(p.engine, domain, "commit")
+
+	if err != nil {
+		return false, err
+	}
+
+	state, err := dal.GetLog(p.engine, domain, "state")
+
+	if err != nil {
+		return false, err
+	}
+
+	ok := log != nil && log.Head != nil && state != nil && state.Head != nil && uuid.Equal(*log.Head, *state.Head)
+
+	p.indexed[domain] = ok
+
+	return ok, nil
+}
+
+// facts returns the currently asserted facts about the entity in the domain.
+func (p *puller) facts(domain string, ident *origins.Ident) (origins.Facts, error) {
+	ok, err := p.useIndex(domain)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if !ok {
+		state, err := p.state(domain)
+
+		if err != nil {
+			return nil, err
+		}
+
+		return state[*ident], nil
+	}
+
+	state, err := dal.GetState(p.engine, domain, ident)
+
+	if err != nil {
+		return nil, err
+	}
+
+	// The index holds the most recent fact about each attribute and value,
+	// including retractions.
+	var facts origins.Facts
+
+	for _, f := range state {
+		if f.Operation == origins.Assertion {
+			facts = append(facts, f)
+		}
+	}
+
+	return facts, nil
+}
+
+// state returns the currently asserted facts in the domain grouped by entity.
+func (p *puller) state(domain string) (map[origins.Ident]origins.Facts, error) {
+	if s, ok := p.states[domain]; ok {
+		return s, nil
+	}
+
+	log, err := OpenLog(p.engine, domain, "commit")
+
+	if err == ErrDoesNotExist {
+		p.states[domain] = nil
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	facts, err := origins.ReadAll(log.StateAsof(p.asof))
+
+	if err != nil {
+		return nil, err
+	}
+
+	s := make(map[origins.Ident]origins.Facts)
+
+	for _, f := range facts {
+		s[*f.Entity] = append(s[*f.Entity], f)
+	}
+
+	p.states[domain] = s
+
+	return s, nil
+}
+
+// pull materializes the entity and the entities its values refer to up to
+// the depth. Nil is returned if the entity does not exist.
+func (p *puller) pull(domain string, ident *origins.Ident, depth int) (*EntityState, error) {
+	facts, err := p.facts(domain, ident)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if len(facts) == 0 {
+		return nil, nil
+	}
+
+	e := EntityState{
+		Domain: domain,
+		Ident:  ident,
+		Attrs:  make(map[string][]*Value),
+	}
+
+	for _, f := range facts {
+		v := Value{
+			Value:       f.Value,
+			Time:        f.Time,
+			Transaction: f.Transaction,
+		}
+
+		// Values with a domain refer to an entity in that domain.
+		if depth > 0 && f.Value.Domain != "" {
+			if v.Ref, err = p.pull(f.Value.Domain, f.Value, depth-1); err != nil {
+				return nil, err
+			}
+		}
+
+		key := f.Attribute.String()
+		e.Attrs[key] = append(e.Attrs[key], &v)
+	}
+
+	return &e, nil
+}
+
+// Entity returns the state of the entity in the domain as of the time. If the
+// entity identity does not have a domain, the domain is used. If the depth is
+// greater than zero, the values that refer to other entities are followed
+// and materialized up to that depth. References are read from the domain of
+// the value. ErrNoEntity is returned if no facts are asserted about the entity.
+func Entity(engine storage.Engine, domain string, ident *origins.Ident, asof time.Time, depth int) (*EntityState, error) {
+	if ident.Domain == "" {
+		ident = &origins.Ident{
+			Domain: domain,
+			Name:   ident.Name,
+		}
+	}
+
+	p := puller{
+		engine:  engine,
+		asof:    asof,
+		states:  make(map[string]map[origins.Ident]origins.Facts),
+		indexed: make(map[string]bool),
+	}
+
+	if _, err := OpenLog(engine, domain, "commit"); err != nil {
+		return nil, err
+	}
+
+	e, err := p.pull(domain, ident, depth)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if e == nil {
+		return nil, ErrNoEntity
+	}
+
+	return e, nil
+}
@@ -0,0 +1,87 @@
+package view_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/chop-dbhi/origins"
+	"github.com/chop-dbhi/origins/dal"
+	"github.com/chop-dbhi/origins/testutil/txtest"
+	"github.com/chop-dbhi/origins/view"
+)
+
+func TestEntity(t *testing.T) {
+	engine, _ := origins.Init("memory", nil)
+
+	tx := txtest.TransactCSV(t, engine, "test", `
+domain,entity,attribute,value_domain,value
+test,bob,city,,Norristown
+test,bob,likes,,soccer
+test,bob,employer,companies,chop
+companies,chop,name,,Children's Hospital
+companies,chop,city,,Philadelphia
+`)
+
+	txtest.TransactCSV(t, engine, "test", `
+operation,entity,attribute,value
+retract,bob,city,Norristown
+assert,bob,city,Bethlehem
+`)
+
+	bob := &origins.Ident{Name: "bob"}
+
+	e, err := view.Entity(engine, "test", bob, tx.EndTime, 0)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	city := &origins.Ident{Domain: "test", Name: "city"}
+
+	if v := e.Get(city); len(v) != 1 || v[0].Value.Name != "Norristown" || v[0].Transaction != tx.ID {
+		t.Errorf("expected city as of the first transaction, got %v", v)
+	}
+
+	employer := e.Get(&origins.Ident{Domain: "test", Name: "employer"})
+
+	if len(employer) != 1 || employer[0].Ref != nil {
+		t.Fatalf("expected unfollowed reference, got %v", employer)
+	}
+
+	e, err = view.Entity(engine, "test", bob, time.Time{}, 1)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if v := e.Get(city); len(v) != 1 || v[0].Value.Name != "Bethlehem" {
+		t.Errorf("expected current city, got %v", v)
+	}
+
+	ref := e.Get(&origins.Ident{Domain: "test", Name: "employer"})[0].Ref
+
+	if ref == nil {
+		t.Fatal("expected reference to be followed")
+	}
+
+	if v := ref.Get(&origins.Ident{Domain: "companies", Name: "city"}); len(v) != 1 || v[0].Value.Name != "Philadelphia" {
+		t.Errorf("expected referenced city, got %v", v)
+	}
+
+	if _, err = view.Entity(engine, "test", &origins.Ident{Name: "sue"}, time.Time{}, 0); err != view.ErrNoEntity {
+		t.Errorf("expected no entity error, got %v", err)
+	}
+
+	// The log is read if the current-state index is out of date.
+	dal.DeleteLog(engine, "test", "state")
+
+	e, err = view.Entity(engine, "test", bob, time.Time{}, 0)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if v := e.Get(city); len(v) != 1 || v[0].Value.Name != "Bethlehem" {
+		t.Errorf("expected current city, got %v", v)
+	}
+}
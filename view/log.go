@@ -2,6 +2,7 @@ package view
 
 import (
 	"errors"
+	"fmt"
 	"io"
 	"time"
 
@@ -22,6 +23,18 @@ type logView struct {
 	asof  time.Time
 	since time.Time
 
+	// Bounds of the valid time of the facts.
+	validAsof  time.Time
+	validSince time.Time
+
+	// Bounds of the transactions of the segments.
+	asofTx  uint64
+	sinceTx uint64
+
+	// If true, segments are read oldest first from the collected segments.
+	forward  bool
+	segments []*dal.Segment
+
 	engine  storage.Engine
 	segment *dal.Segment
 	err     error
@@ -62,23 +75,117 @@ func (li *logView) nextSegment() error {
 			return err
 		}
 
+		// The remaining segments are older than the lower bounds.
+		if li.passed(seg) {
+			return io.EOF
+		}
+
 		// Segment next segment. This is done before checking if it is in range so
 		// it can be evaluated in the next iteration is necessary.
 		li.segment = seg
 
-		// Too late, skip segment.
-		if !li.asof.IsZero() && seg.Time.After(li.asof) {
-			continue
+		if li.inRange(seg) {
+			break
+		}
+	}
+
+	return nil
+}
+
+// inRange returns true if the segment is within the time and transaction bounds.
+func (li *logView) inRange(seg *dal.Segment) bool {
+	// Too late, skip segment.
+	if !li.asof.IsZero() && seg.Time.After(li.asof) {
+		return false
+	}
+
+	// Too early, skip segment.
+	if !li.since.IsZero() && seg.Time.Before(li.since) {
+		return false
+	}
+
+	if li.asofTx > 0 && seg.Transaction > li.asofTx {
+		return false
+	}
+
+	if li.sinceTx > 0 && seg.Transaction < li.sinceTx {
+		return false
+	}
+
+	return true
+}
+
+// passed returns true if the segment and every segment it succeeds are older
+// than the lower bounds, so the rest of the log does not need to be read.
+func (li *logView) passed(seg *dal.Segment) bool {
+	// The bounds of the older segments are unknown.
+	if seg.MaxTransaction == 0 {
+		return false
+	}
+
+	if li.sinceTx > 0 && seg.MaxTransaction < li.sinceTx {
+		return true
+	}
+
+	if !li.since.IsZero() && seg.MaxTime.Before(li.since) {
+		return true
+	}
+
+	return false
+}
+
+// collect reads the segments in range from the head of the log. Segments
+// only link to older segments, so they must be collected before the log
+// can be read oldest first. The walk stops at the lower bounds of the view.
+func (li *logView) collect() error {
+	li.segments = make([]*dal.Segment, 0)
+
+	for id := li.head; id != nil; {
+		seg, err := dal.GetSegment(li.engine, li.domain, id)
+
+		if err != nil {
+			return err
+		}
+
+		if seg == nil {
+			return fmt.Errorf("log: segment %s does not exist", id)
 		}
 
-		// Too early, skip segment.
-		if !li.since.IsZero() && seg.Time.Before(li.since) {
-			continue
+		if li.passed(seg) {
+			break
+		}
+
+		if li.inRange(seg) {
+			li.segments = append(li.segments, seg)
+		}
+
+		id = seg.Next
+	}
+
+	return nil
+}
+
+// nextForwardSegment sets the next oldest segment.
+func (li *logView) nextForwardSegment() error {
+	li.bindex = 0
+	li.block = nil
+
+	if li.segments == nil {
+		if err := li.collect(); err != nil {
+			return err
 		}
+	}
 
-		break
+	n := len(li.segments)
+
+	if n == 0 {
+		return io.EOF
 	}
 
+	// Collected newest first.
+	li.segment = li.segments[n-1]
+	li.segments = li.segments[:n-1]
+
 	return nil
 }
 
@@ -90,9 +197,16 @@ func (li *logView) nextBlock() error {
 		return nil
 	}
 
-	// First segment or there are no blocks left in segment.
-	if li.segment == nil || li.bindex == li.segment.Blocks {
-		if err := li.nextSegment(); err != nil {
+	// First segment or there are no blocks left in segment. Segments
+	// without any blocks, such as those emptied by an excision, are skipped.
+	for li.segment == nil || li.bindex == li.segment.Blocks {
+		next := li.nextSegment
+
+		if li.forward {
+			next = li.nextForwardSegment
+		}
+
+		if err := next(); err != nil {
 			return err
 		}
 	}
@@ -116,23 +230,49 @@ func (li *logView) nextBlock() error {
 	return nil
 }
 
-func (li *logView) Next() *origins.Fact {
-	if li.err != nil {
-		return nil
+// valid returns true if the valid time of the fact is within the bounds.
+// Facts without a valid time are valid from the time they were transacted.
+func (li *logView) valid(f *origins.Fact) bool {
+	t := f.Time
+
+	if t.IsZero() {
+		t = li.segment.Time
 	}
 
-	if err := li.nextBlock(); err != nil {
-		li.err = err
-		return nil
+	if !li.validAsof.IsZero() && t.After(li.validAsof) {
+		return false
+	}
+
+	if !li.validSince.IsZero() && t.Before(li.validSince) {
+		return false
 	}
 
-	fact := li.block.Next()
+	return true
+}
+
+func (li *logView) Next() *origins.Fact {
+	for {
+		if li.err != nil {
+			return nil
+		}
+
+		if err := li.nextBlock(); err != nil {
+			li.err = err
+			return nil
+		}
+
+		fact := li.block.Next()
+
+		if fact == nil {
+			return nil
+		}
 
-	if fact != nil {
 		li.bcount++
-	}
 
-	return fact
+		if li.valid(fact) {
+			return fact
+		}
+	}
 }
 
 func (li *logView) Err() error {
@@ -152,6 +292,7 @@ func (li *logView) Err() error {
 type merger struct {
 	iterators []origins.Iterator
 	next      []*origins.Fact
+	ascending bool
 	err       error
 }
 
@@ -195,7 +336,8 @@ func (m *merger) Next() *origins.Fact {
 
 		// Find the highest tx ID, which denotes the newest fact.
 		// (Iterators return facts in the order of newest facts first).
-		if tx == maxTx || f.Transaction > tx {
+		// For ascending iterators, the lowest tx ID is the oldest fact.
+		if tx == maxTx || (!m.ascending && f.Transaction > tx) || (m.ascending && f.Transaction < tx) {
 			tx = f.Transaction
 			idx = i
 		}
@@ -226,6 +368,16 @@ func Merge(iterators ...origins.Iterator) origins.Iterator {
 	}
 }
 
+// MergeAscending merges multiple fact streams read oldest first, such as
+// forward views of logs, into one ordered by transaction.
+func MergeAscending(iterators ...origins.Iterator) origins.Iterator {
+	return &merger{
+		iterators: iterators,
+		next:      make([]*origins.Fact, len(iterators)),
+		ascending: true,
+	}
+}
+
 // deduplicator maintains the state of a steam of unique facts
 type deduplicator struct {
 	iter          origins.Iterator
@@ -300,18 +452,89 @@ type Log struct {
 	engine storage.Engine
 }
 
-// View returns a view of the log for the specified time period. It is safe for
+// Options bound the facts read from a log. Zero values are unbounded.
+type Options struct {
+	// Bounds of the time the facts were transacted.
+	Since time.Time
+	Asof  time.Time
+
+	// Bounds of the time the facts are valid. Facts without a valid time are
+	// considered valid from the time they were transacted.
+	ValidSince time.Time
+	ValidAsof  time.Time
+
+	// Bounds of the transactions the facts were committed in. Unlike time
+	// bounds, these are unambiguous for transactions committed at the same
+	// time or on hosts with skewed clocks.
+	SinceTx uint64
+	AsofTx  uint64
+
+	// If true, facts are read oldest first in the order they were committed.
+	// Since segments only link to older segments, the segments in range are
+	// read before the first fact is returned.
+	Forward bool
+}
+
+// Read returns a view of the log bounded by the options. It is safe for
 // multiple consumers to create views of a log.
-func (l *Log) View(since, asof time.Time) origins.Iterator {
+func (l *Log) Read(o Options) origins.Iterator {
 	return &logView{
-		domain: l.log.Domain,
-		head:   l.log.Head,
-		engine: l.engine,
-		since:  since,
-		asof:   asof,
+		domain:     l.log.Domain,
+		head:       l.log.Head,
+		engine:     l.engine,
+		since:      o.Since,
+		asof:       o.Asof,
+		validSince: o.ValidSince,
+		validAsof:  o.ValidAsof,
+		sinceTx:    o.SinceTx,
+		asofTx:     o.AsofTx,
+		forward:    o.Forward,
 	}
 }
 
+// View returns a view of the log for the specified time period. It is safe for
+// multiple consumers to create views of a log.
+func (l *Log) View(since, asof time.Time) origins.Iterator {
+	return l.Read(Options{
+		Since: since,
+		Asof:  asof,
+	})
+}
+
+// Bitemporal returns a view of the log bounded by the time the facts were
+// transacted and by the time the facts are valid. For example, what was known
+// as of A about the world as of B is: Bitemporal(time.Time{}, A, time.Time{}, B)
+// Facts without a valid time are considered valid from the time they were
+// transacted.
+func (l *Log) Bitemporal(since, asof, validSince, validAsof time.Time) origins.Iterator {
+	return l.Read(Options{
+		Since:      since,
+		Asof:       asof,
+		ValidSince: validSince,
+		ValidAsof:  validAsof,
+	})
+}
+
+// Forward returns a view of the log for the specified time period that reads
+// facts oldest first in the order they were committed.
+func (l *Log) Forward(since, asof time.Time) origins.Iterator {
+	return l.Read(Options{
+		Since:   since,
+		Asof:    asof,
+		Forward: true,
+	})
+}
+
+// ViewTx returns a view of the log bounded by the transactions the facts were
+// committed in. Both bounds are inclusive and zero is unbounded, so the state
+// after transaction N is: State(ViewTx(0, N))
+func (l *Log) ViewTx(sinceTx, asofTx uint64) origins.Iterator {
+	return l.Read(Options{
+		SinceTx: sinceTx,
+		AsofTx:  asofTx,
+	})
+}
+
 // Now returns a view of the log with a time boundary set to the current time.
 // This is equivalent to: Asof(time.Now().UTC())
 func (l *Log) Now() origins.Iterator {
@@ -328,6 +551,17 @@ func (l *Log) Since(t time.Time) origins.Iterator {
 	return l.View(t.UTC(), time.Time{})
 }
 
+// State returns the facts that are currently asserted in the log.
+// This is equivalent to: StateAsof(time.Now().UTC())
+func (l *Log) State() origins.Iterator {
+	return l.StateAsof(time.Now())
+}
+
+// StateAsof returns the facts that were asserted in the log as of the time.
+func (l *Log) StateAsof(t time.Time) origins.Iterator {
+	return State(l.Asof(t))
+}
+
 // OpenLog opens a log for reading.
 func OpenLog(engine storage.Engine, domain, name string) (*Log, error) {
 	log, err := dal.GetLog(engine, domain, name)
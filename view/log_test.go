@@ -1,13 +1,16 @@
 package view_test
 
 import (
+	"bytes"
 	"strconv"
 	"testing"
 	"time"
 
 	"github.com/chop-dbhi/origins"
+	"github.com/chop-dbhi/origins/dal"
 	"github.com/chop-dbhi/origins/storage"
 	"github.com/chop-dbhi/origins/testutil"
+	"github.com/chop-dbhi/origins/testutil/txtest"
 	"github.com/chop-dbhi/origins/transactor"
 	"github.com/chop-dbhi/origins/view"
 )
@@ -440,3 +443,307 @@ func TestLogSince(t *testing.T) {
 		t.Errorf("expected 0 facts, got %d", len(facts))
 	}
 }
+
+func TestLogBitemporal(t *testing.T) {
+	engine, _ := origins.Init("memory", nil)
+
+	tx := txtest.TransactCSV(t, engine, "test", `
+entity,attribute,value,time
+bob,city,Norristown,2010-01-01
+bob,likes,soccer,
+sue,city,Allentown,2012-06-01
+`)
+
+	txtest.TransactCSV(t, engine, "test", `
+entity,attribute,value,time
+bob,city,Bethlehem,2014-01-01
+`)
+
+	log := openLog(t, engine)
+
+	parse := func(s string) time.Time {
+		v, err := time.Parse("2006-01-02", s)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		return v
+	}
+
+	var zero time.Time
+
+	checkState(t, view.State(log.Bitemporal(zero, zero, zero, parse("2011-01-01"))), []string{
+		"bob city Norristown",
+	})
+
+	// Facts without a valid time are valid from the time they were transacted.
+	checkState(t, view.State(log.Bitemporal(zero, zero, parse("2011-01-01"), zero)), []string{
+		"bob city Bethlehem",
+		"bob likes soccer",
+		"sue city Allentown",
+	})
+
+	checkState(t, view.State(log.Bitemporal(zero, zero, zero, parse("2015-01-01"))), []string{
+		"bob city Bethlehem",
+		"bob city Norristown",
+		"sue city Allentown",
+	})
+
+	checkState(t, view.State(log.Bitemporal(zero, zero, zero, tx.EndTime)), []string{
+		"bob city Bethlehem",
+		"bob city Norristown",
+		"bob likes soccer",
+		"sue city Allentown",
+	})
+
+	// What was known as of the first transaction about 2015.
+	checkState(t, view.State(log.Bitemporal(zero, tx.EndTime, zero, parse("2015-01-01"))), []string{
+		"bob city Norristown",
+		"sue city Allentown",
+	})
+}
+
+func TestLogForward(t *testing.T) {
+	engine, _ := origins.Init("memory", nil)
+
+	tx1 := txtest.TransactCSV(t, engine, "test", `
+entity,attribute,value
+bob,city,Norristown
+sue,city,Bethlehem
+`)
+
+	tx2 := txtest.TransactCSV(t, engine, "test", `
+entity,attribute,value
+bob,city,Bethlehem
+bob,city,Philadelphia
+`)
+
+	tx3 := txtest.TransactCSV(t, engine, "test", `
+entity,attribute,value
+bob,city,Allentown
+sue,city,Allentown
+`)
+
+	log := openLog(t, engine)
+
+	facts, err := origins.ReadAll(log.Forward(time.Time{}, time.Time{}))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []string{"Norristown", "Bethlehem", "Bethlehem", "Philadelphia", "Allentown", "Allentown"}
+	txs := []uint64{tx1.ID, tx1.ID, tx2.ID, tx2.ID, tx3.ID, tx3.ID}
+
+	if len(facts) != len(expected) {
+		t.Fatalf("expected %d facts, got %d", len(expected), len(facts))
+	}
+
+	for i, f := range facts {
+		if f.Value.Name != expected[i] || f.Transaction != txs[i] {
+			t.Errorf("fact %d: expected %s in %d, got %s in %d", i, expected[i], txs[i], f.Value.Name, f.Transaction)
+		}
+	}
+
+	// Bounded by the second transaction.
+	facts, err = origins.ReadAll(log.Forward(tx1.EndTime, tx2.EndTime))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(facts) != 2 || facts[0].Transaction != tx2.ID {
+		t.Errorf("expected 2 facts of transaction %d, got %s", tx2.ID, facts)
+	}
+
+	// Timelines are derived from the forward view in ascending order.
+	events, err := view.Timeline(log.Forward(time.Time{}, time.Time{}), view.Ascending)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	types := []view.EventType{view.Add, view.Add, view.Change, view.Change, view.Change, view.Change}
+
+	if len(events) != len(types) {
+		t.Fatalf("expected %d events, got %d", len(types), len(events))
+	}
+
+	for i, e := range events {
+		if e.Type != types[i] {
+			t.Errorf("event %d: expected %s, got %s", i, types[i], e.Type)
+		}
+	}
+
+	if e := events[len(events)-1]; e.Before.Value.Name != "Bethlehem" || e.After.Value.Name != "Allentown" {
+		t.Errorf("expected sue to change from Bethlehem to Allentown, got %s to %s", e.Before.Value.Name, e.After.Value.Name)
+	}
+}
+
+func TestMergeAscending(t *testing.T) {
+	domains := []string{"test", "another_test"}
+
+	engine := randMultidomainStorage(domains, 10, 10)
+
+	iters := make([]origins.Iterator, len(domains))
+
+	for i, d := range domains {
+		log, err := view.OpenLog(engine, d, "commit")
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		iters[i] = log.Forward(time.Time{}, time.Time{})
+	}
+
+	facts, err := origins.ReadAll(view.MergeAscending(iters...))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(facts) != 100 {
+		t.Errorf("expected 100 facts, got %d", len(facts))
+	}
+
+	for i := 1; i < len(facts); i++ {
+		if facts[i].Transaction < facts[i-1].Transaction {
+			t.Fatalf("transactions are ordered incorrectly")
+		}
+	}
+}
+
+func TestLogViewTx(t *testing.T) {
+	engine, _ := origins.Init("memory", nil)
+
+	tx1 := txtest.TransactCSV(t, engine, "test", `
+entity,attribute,value
+bob,city,Norristown
+`)
+
+	tx2 := txtest.TransactCSV(t, engine, "test", `
+operation,entity,attribute,value
+retract,bob,city,Norristown
+assert,bob,city,Bethlehem
+`)
+
+	txtest.TransactCSV(t, engine, "test", `
+entity,attribute,value
+sue,city,Allentown
+`)
+
+	log := openLog(t, engine)
+
+	// The state after each transaction.
+	checkState(t, view.State(log.ViewTx(0, tx1.ID)), []string{
+		"bob city Norristown",
+	})
+
+	checkState(t, view.State(log.ViewTx(0, tx2.ID)), []string{
+		"bob city Bethlehem",
+	})
+
+	checkState(t, view.State(log.ViewTx(0, 0)), []string{
+		"bob city Bethlehem",
+		"sue city Allentown",
+	})
+
+	facts, err := origins.ReadAll(log.ViewTx(tx2.ID, tx2.ID))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(facts) != 2 {
+		t.Errorf("expected 2 facts, got %d", len(facts))
+	}
+
+	for _, f := range facts {
+		if f.Transaction != tx2.ID {
+			t.Errorf("expected transaction %d, got %d", tx2.ID, f.Transaction)
+		}
+	}
+
+	// Combined with forward reading.
+	facts, err = origins.ReadAll(log.Read(view.Options{
+		SinceTx: tx2.ID,
+		Forward: true,
+	}))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(facts) != 3 || facts[0].Transaction != tx2.ID || facts[2].Entity.Name != "sue" {
+		t.Errorf("expected the facts of the last two transactions oldest first, got %s", facts)
+	}
+}
+
+func TestLogLowerBound(t *testing.T) {
+	engine, _ := origins.Init("memory", nil)
+
+	txtest.TransactCSV(t, engine, "test", `
+entity,attribute,value
+bob,name,Bob
+`)
+
+	txtest.TransactCSV(t, engine, "test", `
+entity,attribute,value
+bob,city,Norristown
+`)
+
+	// Started before the next transaction, but committed after it.
+	tx2, err := transactor.New(engine, transactor.Options{
+		DefaultDomain: "test",
+	})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tx3 := txtest.TransactCSV(t, engine, "test", `
+entity,attribute,value
+sue,city,Allentown
+`)
+
+	origins.Copy(origins.NewCSVReader(bytes.NewBufferString(`
+entity,attribute,value
+bob,likes,soccer
+`)), tx2)
+
+	if err = tx2.Commit(); err != nil {
+		t.Fatal(err)
+	}
+
+	// Remove the oldest segment. The segment before it is older than the
+	// lower bound, so the walk stops before reaching it.
+	l, _ := dal.GetLog(engine, "test", "commit")
+	seg, _ := dal.GetSegment(engine, "test", l.Head)
+	seg, _ = dal.GetSegment(engine, "test", seg.Next)
+	seg, _ = dal.GetSegment(engine, "test", seg.Next)
+
+	if err = dal.DeleteSegment(engine, "test", seg.Next); err != nil {
+		t.Fatal(err)
+	}
+
+	log := openLog(t, engine)
+
+	for _, forward := range []bool{false, true} {
+		// The head segment is of an earlier transaction than the lower
+		// bound, but the segment after it is not.
+		facts, err := origins.ReadAll(log.Read(view.Options{
+			SinceTx: tx3.ID,
+			Forward: forward,
+		}))
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if len(facts) != 1 || facts[0].Transaction != tx3.ID {
+			t.Errorf("expected the fact of transaction %d, got %s", tx3.ID, facts)
+		}
+	}
+}
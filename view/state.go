@@ -0,0 +1,148 @@
+package view
+
+import (
+	"strings"
+
+	"github.com/chop-dbhi/origins"
+)
+
+// Attribute of a schema declaration that sets the cardinality of an attribute.
+const cardinalityAttr = "cardinality"
+
+// eavKey identifies an entity, attribute and value.
+type eavKey [3]origins.Ident
+
+// eaKey identifies an entity and attribute.
+type eaKey [2]origins.Ident
+
+// stateView is an iterator of the currently asserted facts in a stream.
+type stateView struct {
+	iter  origins.Iterator
+	facts origins.Iterator
+	err   error
+}
+
+func (s *stateView) Next() *origins.Fact {
+	if s.err != nil {
+		return nil
+	}
+
+	if s.facts == nil {
+		var facts origins.Facts
+
+		if facts, s.err = current(s.iter); s.err != nil {
+			return nil
+		}
+
+		s.facts = origins.NewBuffer(facts)
+	}
+
+	return s.facts.Next()
+}
+
+func (s *stateView) Err() error {
+	return s.err
+}
+
+// cardinalities returns the set of attributes declared with a cardinality of
+// one in the current state. If more than one cardinality is asserted for an
+// attribute, the most recent one applies.
+func cardinalities(facts origins.Facts) map[origins.Ident]bool {
+	one := make(map[origins.Ident]bool)
+
+	for _, f := range facts {
+		if f.Attribute.Domain != origins.AttrsDomain || f.Attribute.Name != cardinalityAttr {
+			continue
+		}
+
+		if f.Value.Domain != origins.CardinalitiesDomain {
+			continue
+		}
+
+		one[*f.Entity] = strings.ToLower(f.Value.Name) == "one"
+	}
+
+	return one
+}
+
+// current folds the facts in the stream into the currently asserted facts.
+func current(iter origins.Iterator) (origins.Facts, error) {
+	facts, err := origins.ReadAll(iter)
+
+	if err != nil {
+		return nil, err
+	}
+
+	// Logs are read newest first. The order of facts within a transaction
+	// is preserved by the stable sort.
+	origins.Timsort(facts, origins.TransactionComparator)
+
+	// The most recent fact about each entity, attribute and value in
+	// the order they were first seen.
+	var (
+		keys   []eavKey
+		latest = make(map[eavKey]*origins.Fact)
+	)
+
+	for _, f := range facts {
+		k := eavKey{*f.Entity, *f.Attribute, *f.Value}
+
+		if _, ok := latest[k]; !ok {
+			keys = append(keys, k)
+		}
+
+		latest[k] = f
+	}
+
+	var asserted origins.Facts
+
+	for _, k := range keys {
+		if f := latest[k]; f.Operation == origins.Assertion {
+			asserted = append(asserted, f)
+		}
+	}
+
+	one := cardinalities(asserted)
+
+	// Attributes with a cardinality of one only have the most recently
+	// asserted value.
+	values := make(map[eaKey]*origins.Fact)
+
+	for _, f := range asserted {
+		if !one[*f.Attribute] {
+			continue
+		}
+
+		k := eaKey{*f.Entity, *f.Attribute}
+
+		if p, ok := values[k]; !ok || f.Transaction >= p.Transaction {
+			values[k] = f
+		}
+	}
+
+	state := make(origins.Facts, 0, len(asserted))
+
+	for _, f := range asserted {
+		if one[*f.Attribute] && values[eaKey{*f.Entity, *f.Attribute}] != f {
+			continue
+		}
+
+		state = append(state, f)
+	}
+
+	origins.Timsort(state, origins.EAVTComparator)
+
+	return state, nil
+}
+
+// State returns an iterator of the facts that are currently asserted in the
+// stream. Facts are applied in transaction order, so a retraction removes
+// the fact asserted prior to it. Attributes declared with a cardinality of
+// one in the stream, such as the schema of a domain, only have the most
+// recently asserted value. Facts are returned ordered by entity, attribute
+// and value.
+func State(iter origins.Iterator) origins.Iterator {
+	return &stateView{
+		iter: iter,
+	}
+}
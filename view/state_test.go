@@ -0,0 +1,122 @@
+package view_test
+
+import (
+	"testing"
+
+	"github.com/chop-dbhi/origins"
+	"github.com/chop-dbhi/origins/storage"
+	"github.com/chop-dbhi/origins/testutil"
+	"github.com/chop-dbhi/origins/testutil/txtest"
+	"github.com/chop-dbhi/origins/view"
+)
+
+// openLog opens the commit log of the test domain. The head of the log
+// is read when it is opened.
+func openLog(t *testing.T, engine storage.Engine) *view.Log {
+	log, err := view.OpenLog(engine, "test", "commit")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return log
+}
+
+func checkState(t *testing.T, iter origins.Iterator, expected []string) {
+	facts, err := origins.ReadAll(iter)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	actual := make([]string, len(facts))
+
+	for i, f := range facts {
+		if f.Operation != origins.Assertion {
+			t.Errorf("expected assertion, got %s", f)
+		}
+
+		actual[i] = f.Entity.Name + " " + f.Attribute.Name + " " + f.Value.Name
+	}
+
+	testutil.CheckStrings(t, expected, actual)
+}
+
+func TestState(t *testing.T) {
+	engine, _ := origins.Init("memory", nil)
+
+	tx := txtest.TransactCSV(t, engine, "test", `
+entity,attribute,value
+bob,city,Norristown
+bob,likes,soccer
+sue,city,Allentown
+`)
+
+	txtest.TransactCSV(t, engine, "test", `
+operation,entity,attribute,value
+retract,bob,city,Norristown
+assert,bob,city,Bethlehem
+assert,bob,likes,football
+retract,sue,city,Allentown
+`)
+
+	log := openLog(t, engine)
+
+	checkState(t, log.State(), []string{
+		"bob city Bethlehem",
+		"bob likes football",
+		"bob likes soccer",
+	})
+
+	checkState(t, log.StateAsof(tx.EndTime), []string{
+		"bob city Norristown",
+		"bob likes soccer",
+		"sue city Allentown",
+	})
+
+	// Facts retracted and asserted again.
+	txtest.TransactCSV(t, engine, "test", `
+entity,attribute,value
+sue,city,Allentown
+`)
+
+	checkState(t, openLog(t, engine).State(), []string{
+		"bob city Bethlehem",
+		"bob likes football",
+		"bob likes soccer",
+		"sue city Allentown",
+	})
+}
+
+func TestStateCardinality(t *testing.T) {
+	engine, _ := origins.Init("memory", nil)
+
+	txtest.TransactCSV(t, engine, "test", `
+entity,attribute,value
+bob,likes,soccer
+bob,likes,football
+`)
+
+	log := openLog(t, engine)
+
+	checkState(t, log.State(), []string{
+		"bob likes football",
+		"bob likes soccer",
+	})
+
+	// Declaring the cardinality applies to the facts already asserted.
+	txtest.TransactCSV(t, engine, "test", `
+entity,attribute_domain,attribute,value_domain,value
+likes,origins.attrs,cardinality,origins.cardinalities,one
+`)
+
+	txtest.TransactCSV(t, engine, "test", `
+entity,attribute,value
+bob,likes,hockey
+`)
+
+	checkState(t, openLog(t, engine).State(), []string{
+		"bob likes hockey",
+		"likes cardinality one",
+	})
+}
@@ -0,0 +1,244 @@
+package view
+
+import (
+	"errors"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/chop-dbhi/origins"
+	"github.com/chop-dbhi/origins/dal"
+	"github.com/chop-dbhi/origins/storage"
+	"github.com/satori/go.uuid"
+)
+
+// ErrLogRewritten is returned by a subscription if the last delivered segment
+// is no longer part of the log.
+var ErrLogRewritten = errors.New("subscribe: log was rewritten")
+
+// DefaultPollInterval is the interval the head of a log is checked for new
+// commits if no interval is supplied.
+var DefaultPollInterval = time.Second
+
+// segmentView is an iterator of the facts in a single segment.
+type segmentView struct {
+	engine  storage.Engine
+	segment *dal.Segment
+	block   *dal.BlockDecoder
+	bindex  int
+	err     error
+}
+
+func (s *segmentView) Next() *origins.Fact {
+	for s.err == nil {
+		if s.block != nil {
+			if f := s.block.Next(); f != nil {
+				return f
+			}
+
+			if s.err = s.block.Err(); s.err != nil {
+				return nil
+			}
+		}
+
+		if s.bindex == s.segment.Blocks {
+			s.err = io.EOF
+			return nil
+		}
+
+		block, err := dal.GetBlock(s.engine, s.segment.Domain, s.segment.UUID, s.bindex)
+
+		if err != nil {
+			s.err = err
+			return nil
+		}
+
+		if block == nil {
+			s.err = io.EOF
+			return nil
+		}
+
+		s.block = dal.NewBlockDecoder(block, s.segment.Domain, s.segment.Transaction)
+		s.bindex++
+	}
+
+	return nil
+}
+
+func (s *segmentView) Err() error {
+	if s.err == io.EOF {
+		return nil
+	}
+
+	return s.err
+}
+
+// Commit is a segment committed to the log of a domain.
+type Commit struct {
+	Domain      string
+	Transaction uint64
+	Time        time.Time
+	Count       int
+
+	engine  storage.Engine
+	segment *dal.Segment
+}
+
+// Facts returns an iterator of the facts in the commit.
+func (c *Commit) Facts() origins.Iterator {
+	return &segmentView{
+		engine:  c.engine,
+		segment: c.segment,
+	}
+}
+
+// Subscription delivers the segments committed to the log of a domain on C
+// in the order they were committed. The head of the log is polled, so commits
+// are delivered at most an interval after they occur.
+type Subscription struct {
+	// C receives each commit. It is closed when the subscription stops.
+	C <-chan *Commit
+
+	c        chan *Commit
+	engine   storage.Engine
+	domain   string
+	interval time.Duration
+	stop     chan struct{}
+	stopOnce sync.Once
+	err      error
+
+	// Last delivered segment.
+	head *uuid.UUID
+}
+
+// Err returns the error that stopped the subscription. It must only be
+// called after C is closed.
+func (s *Subscription) Err() error {
+	return s.err
+}
+
+// Close stops the subscription. It may be called more than once.
+func (s *Subscription) Close() {
+	s.stopOnce.Do(func() {
+		close(s.stop)
+	})
+}
+
+// poll returns the segments committed since the last poll, oldest first.
+// Segments are walked from the head back to the last delivered segment.
+// Segments of the reserved domains may be rebased onto later commits, so
+// their transactions are not necessarily in order. If a segment is missing or
+// the last delivered segment is not found, the log was rewritten.
+func (s *Subscription) poll() ([]*dal.Segment, error) {
+	log, err := dal.GetLog(s.engine, s.domain, "commit")
+
+	if err != nil || log == nil {
+		return nil, err
+	}
+
+	var (
+		seg  *dal.Segment
+		segs []*dal.Segment
+	)
+
+	for id := log.Head; id != nil; id = seg.Next {
+		if s.head != nil && uuid.Equal(*id, *s.head) {
+			break
+		}
+
+		if seg, err = dal.GetSegment(s.engine, s.domain, id); err != nil {
+			return nil, err
+		}
+
+		// The segment was removed or the end of the log was reached
+		// without finding the last delivered segment.
+		if seg == nil || (seg.Next == nil && s.head != nil) {
+			return nil, ErrLogRewritten
+		}
+
+		segs = append(segs, seg)
+	}
+
+	// Reverse to commit order.
+	for i, j := 0, len(segs)-1; i < j; i, j = i+1, j-1 {
+		segs[i], segs[j] = segs[j], segs[i]
+	}
+
+	return segs, nil
+}
+
+func (s *Subscription) run() {
+	defer close(s.c)
+
+	ticker := time.NewTicker(s.interval)
+	defer ticker.Stop()
+
+	for {
+		segs, err := s.poll()
+
+		if err != nil {
+			s.err = err
+			return
+		}
+
+		for _, seg := range segs {
+			c := Commit{
+				Domain:      seg.Domain,
+				Transaction: seg.Transaction,
+				Time:        seg.Time,
+				Count:       seg.Count,
+				engine:      s.engine,
+				segment:     seg,
+			}
+
+			select {
+			case s.c <- &c:
+			case <-s.stop:
+				return
+			}
+
+			s.head = seg.UUID
+		}
+
+		select {
+		case <-ticker.C:
+		case <-s.stop:
+			return
+		}
+	}
+}
+
+// Subscribe returns a subscription to the segments committed to the log of
+// the domain after it is called. The domain does not need to exist yet. If
+// the interval is zero, the DefaultPollInterval is used.
+func Subscribe(engine storage.Engine, domain string, interval time.Duration) (*Subscription, error) {
+	if interval <= 0 {
+		interval = DefaultPollInterval
+	}
+
+	c := make(chan *Commit)
+
+	s := Subscription{
+		C:        c,
+		c:        c,
+		engine:   engine,
+		domain:   domain,
+		interval: interval,
+		stop:     make(chan struct{}),
+	}
+
+	// Start from the current head.
+	log, err := dal.GetLog(engine, domain, "commit")
+
+	if err != nil {
+		return nil, err
+	}
+
+	if log != nil {
+		s.head = log.Head
+	}
+
+	go s.run()
+
+	return &s, nil
+}
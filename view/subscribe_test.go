@@ -0,0 +1,171 @@
+package view_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/chop-dbhi/origins"
+	"github.com/chop-dbhi/origins/dal"
+	"github.com/chop-dbhi/origins/testutil/txtest"
+	"github.com/chop-dbhi/origins/transactor"
+	"github.com/chop-dbhi/origins/view"
+)
+
+func TestSubscribe(t *testing.T) {
+	engine, _ := origins.Init("memory", nil)
+
+	// Commits before subscribing are not delivered.
+	txtest.TransactCSV(t, engine, "test", `
+entity,attribute,value
+bob,city,Norristown
+`)
+
+	sub, err := view.Subscribe(engine, "test", 10*time.Millisecond)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tx1 := txtest.TransactCSV(t, engine, "test", `
+entity,attribute,value
+bob,likes,soccer
+sue,city,Allentown
+`)
+
+	tx2 := txtest.TransactCSV(t, engine, "test", `
+entity,attribute,value
+sue,likes,tennis
+`)
+
+	for _, tx := range []*transactor.Transaction{tx1, tx2} {
+		var c *view.Commit
+
+		select {
+		case c = <-sub.C:
+		case <-time.After(time.Second):
+			t.Fatal("timed out waiting for commit")
+		}
+
+		if c.Transaction != tx.ID {
+			t.Errorf("expected transaction %d, got %d", tx.ID, c.Transaction)
+		}
+
+		facts, err := origins.ReadAll(c.Facts())
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if len(facts) != c.Count {
+			t.Errorf("expected %d facts, got %d", c.Count, len(facts))
+		}
+	}
+
+	sub.Close()
+
+	// Closing a stopped subscription is a no-op.
+	sub.Close()
+
+	for range sub.C {
+	}
+
+	if err = sub.Err(); err != nil {
+		t.Error(err)
+	}
+}
+
+// receive returns the next commit of the subscription.
+func receive(t *testing.T, sub *view.Subscription) *view.Commit {
+	select {
+	case c, ok := <-sub.C:
+		if !ok {
+			t.Fatalf("subscription stopped: %s", sub.Err())
+		}
+
+		return c
+
+	case <-time.After(time.Second):
+		t.Fatal("timed out waiting for commit")
+	}
+
+	return nil
+}
+
+func TestSubscribeRebased(t *testing.T) {
+	engine, _ := origins.Init("memory", nil)
+
+	txtest.TransactCSV(t, engine, "test", `
+entity,attribute,value
+bob,city,Norristown
+`)
+
+	sub, err := view.Subscribe(engine, origins.TransactionsDomain, 10*time.Millisecond)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer sub.Close()
+
+	// The first transaction is committed after the second, so its segment
+	// is rebased onto the segment of a later transaction.
+	tx1, err := transactor.New(engine, transactor.Options{
+		DefaultDomain: "test",
+	})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tx2 := txtest.TransactCSV(t, engine, "test", `
+entity,attribute,value
+sue,city,Allentown
+`)
+
+	if c := receive(t, sub); c.Transaction != tx2.ID {
+		t.Errorf("expected transaction %d, got %d", tx2.ID, c.Transaction)
+	}
+
+	if err = tx1.Commit(); err != nil {
+		t.Fatal(err)
+	}
+
+	if c := receive(t, sub); c.Transaction != tx1.ID {
+		t.Errorf("expected transaction %d, got %d", tx1.ID, c.Transaction)
+	}
+}
+
+func TestSubscribeRewritten(t *testing.T) {
+	engine, _ := origins.Init("memory", nil)
+
+	txtest.TransactCSV(t, engine, "test", `
+entity,attribute,value
+bob,city,Norristown
+`)
+
+	sub, err := view.Subscribe(engine, "test", 10*time.Millisecond)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The domain starts over, so the delivered segment is no longer in
+	// its log.
+	for _, name := range []string{"commit", "state", "index"} {
+		if err = dal.DeleteLog(engine, "test", name); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	txtest.TransactCSV(t, engine, "test", `
+entity,attribute,value
+sue,city,Allentown
+`)
+
+	for range sub.C {
+	}
+
+	if err = sub.Err(); err != view.ErrLogRewritten {
+		t.Errorf("expected %s, got %v", view.ErrLogRewritten, err)
+	}
+}
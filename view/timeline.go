@@ -1,7 +1,10 @@
 package view
 
 import (
+	"encoding/csv"
 	"encoding/json"
+	"fmt"
+	"io"
 
 	"github.com/chop-dbhi/origins"
 	"github.com/chop-dbhi/origins/chrono"
@@ -93,27 +96,141 @@ func (e *Event) MarshalJSON() ([]byte, error) {
 	return json.Marshal(m)
 }
 
-// Timeline returns an ordered set of events derived from the fact iterator.
-// The iterator is assumed to return facts in reverse order by time (newest first)
-// which is what the Log view returns.
-func Timeline(iter origins.Iterator, order Order) ([]*Event, error) {
+var eventCSVHeader = []string{
+	"type",
+	"entity_domain",
+	"entity",
+	"attribute_domain",
+	"attribute",
+	"before_value_domain",
+	"before_value",
+	"after_value_domain",
+	"after_value",
+	"time",
+	"transaction",
+}
+
+// EventCSVWriter writes events in a CSV format. The time and transaction
+// are of the fact that caused the event.
+type EventCSVWriter struct {
+	writer  *csv.Writer
+	started bool
+}
+
+func (w *EventCSVWriter) Write(e *Event) error {
+	if !w.started {
+		w.writer.Write(eventCSVHeader)
+		w.started = true
+	}
+
 	var (
-		key              [4]string
-		err              error
-		fact, prev, next *origins.Fact
-		events           []*Event
-		event            *Event
-		etype            EventType
+		bdom, bval string
+		adom, aval string
+		t, txs     string
 	)
 
-	// Map facts keyed by entity/attribute pairs.
+	if e.Before != nil {
+		bdom = e.Before.Value.Domain
+		bval = e.Before.Value.Name
+	}
+
+	if e.After != nil {
+		adom = e.After.Value.Domain
+		aval = e.After.Value.Name
+		t = chrono.Format(e.After.Time)
+
+		if e.After.Transaction > 0 {
+			txs = fmt.Sprint(e.After.Transaction)
+		}
+	}
+
+	w.writer.Write([]string{
+		e.Type.String(),
+		e.Entity.Domain,
+		e.Entity.Name,
+		e.Attribute.Domain,
+		e.Attribute.Name,
+		bdom,
+		bval,
+		adom,
+		aval,
+		t,
+		txs,
+	})
+
+	return w.writer.Error()
+}
+
+func (w *EventCSVWriter) Flush() error {
+	w.writer.Flush()
+	return w.writer.Error()
+}
+
+func NewEventCSVWriter(w io.Writer) *EventCSVWriter {
+	return &EventCSVWriter{
+		writer: csv.NewWriter(w),
+	}
+}
+
+// EventIterator is an iterator of events. Next returns nil when no more events
+// are available, after which Err returns the error that stopped the iterator.
+type EventIterator interface {
+	Next() *Event
+	Err() error
+}
+
+// ReadAllEvents reads all events from the iterator.
+func ReadAllEvents(iter EventIterator) ([]*Event, error) {
+	var events []*Event
+
+	for {
+		e := iter.Next()
+
+		if e == nil {
+			break
+		}
+
+		events = append(events, e)
+	}
+
+	if err := iter.Err(); err != nil {
+		return nil, err
+	}
+
+	return events, nil
+}
+
+// TimelineIterator derives events from a stream of facts as they are read.
+type TimelineIterator struct {
+	iter  origins.Iterator
+	order Order
+	done  bool
+	err   error
+
+	// Last fact read for each entity/attribute pair.
 	// TODO: benchmark compared to cached identity approach. This is more
 	// resilient since it does not rely on pointers.
-	facts := make(map[[4]string]*origins.Fact)
+	facts map[[4]string]*origins.Fact
+}
+
+// Next returns the next event or nil if the stream of facts is exhausted.
+func (t *TimelineIterator) Next() *Event {
+	var (
+		key        [4]string
+		fact       *origins.Fact
+		prev, next *origins.Fact
+		etype      EventType
+	)
+
+	if t.done {
+		return nil
+	}
 
 	for {
-		if fact = iter.Next(); fact == nil {
-			break
+		if fact = t.iter.Next(); fact == nil {
+			t.done = true
+			t.err = t.iter.Err()
+			return nil
 		}
 
 		// Uniquely identities an entity-attribute pair. The fact domain
@@ -127,19 +244,19 @@ func Timeline(iter origins.Iterator, order Order) ([]*Event, error) {
 		}
 
 		// Swap depending on order.
-		switch order {
+		switch t.order {
 		case Ascending:
 			next = fact
-			prev = facts[key]
+			prev = t.facts[key]
 		case Descending:
 			prev = fact
-			next = facts[key]
+			next = t.facts[key]
 		default:
-			logrus.Panicf("view: unknown order %v", order)
+			logrus.Panicf("view: unknown order %v", t.order)
 		}
 
 		// Update the cache with the current fact.
-		facts[key] = fact
+		t.facts[key] = fact
 
 		// No existing fact. Construct add event
 		if prev == nil || next == nil {
@@ -159,24 +276,51 @@ func Timeline(iter origins.Iterator, order Order) ([]*Event, error) {
 			continue
 		}
 
-		// Construct the event.
-		event = &Event{
+		return &Event{
 			Type:      etype,
 			Entity:    fact.Entity,
 			Attribute: fact.Attribute,
 			Before:    prev,
 			After:     next,
 		}
-
-		events = append(events, event)
 	}
+}
 
-	if err = iter.Err(); err != nil {
-		return nil, err
+// Err returns the error that stopped the iterator.
+func (t *TimelineIterator) Err() error {
+	return t.err
+}
+
+// State returns the last fact read for each entity/attribute pair ordered by
+// entity and attribute. Once the iterator is exhausted, this is the current
+// state (ascending) or the initial state (descending) of the stream. Facts
+// that are retractions denote the attribute had no value.
+func (t *TimelineIterator) State() origins.Facts {
+	state := make(origins.Facts, 0, len(t.facts))
+
+	for _, f := range t.facts {
+		state = append(state, f)
 	}
 
-	// TODO: The final set of facts represent the current state
-	// (ascending) or initial state (descending) of the iterator.
+	origins.Timsort(state, origins.EAVTComparator)
 
-	return events, nil
+	return state
+}
+
+// NewTimeline returns an iterator of the events derived from the stream of
+// facts. The order is the order of the facts in the stream by time.
+func NewTimeline(iter origins.Iterator, order Order) *TimelineIterator {
+	return &TimelineIterator{
+		iter:  iter,
+		order: order,
+		facts: make(map[[4]string]*origins.Fact),
+	}
+}
+
+// Timeline returns an ordered set of events derived from the fact iterator.
+// For the Descending order, the iterator is assumed to return facts in reverse
+// order by time (newest first) which is what the Log view returns. For the
+// Ascending order, facts are oldest first, such as from Log.Forward.
+func Timeline(iter origins.Iterator, order Order) ([]*Event, error) {
+	return ReadAllEvents(NewTimeline(iter, order))
 }
@@ -37,3 +37,42 @@ func TestTimeline(t *testing.T) {
 		t.Errorf("expected 6 events, got %d", len(events))
 	}
 }
+
+func TestTimelineIterator(t *testing.T) {
+	timeline := NewTimeline(buildIter(t), Ascending)
+
+	types := []EventType{Add, Add, Change, Change, Change, Change}
+
+	for i, expected := range types {
+		e := timeline.Next()
+
+		if e == nil {
+			t.Fatalf("expected %d events, got %d", len(types), i)
+		}
+
+		if e.Type != expected {
+			t.Errorf("event %d: expected %s, got %s", i, expected, e.Type)
+		}
+	}
+
+	if e := timeline.Next(); e != nil {
+		t.Errorf("expected no more events, got %s", e.Type)
+	}
+
+	if err := timeline.Err(); err != nil {
+		t.Fatal(err)
+	}
+
+	// The last value of each entity.
+	state := timeline.State()
+
+	if len(state) != 2 {
+		t.Fatalf("expected 2 facts, got %d", len(state))
+	}
+
+	for i, name := range []string{"bob", "sue"} {
+		if f := state[i]; f.Entity.Name != name || f.Value.Name != "Allentown" {
+			t.Errorf("expected %s city Allentown, got %s", name, f)
+		}
+	}
+}